@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+)
+
+// janitorReportHandler reports which sessions the janitor would delete under
+// the current retention policy, without deleting anything.
+func (app *application) janitorReportHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := app.janitor.Sweep(r.Context(), true)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	policy := app.janitor.Policy()
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"policy": envelope{
+			"maxAge":             policy.MaxAge.String(),
+			"maxSessionsPerUser": policy.MaxSessionsPerUser,
+			"maxTotalBytes":      policy.MaxTotalBytes,
+		},
+		"report": report,
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -5,18 +5,21 @@ import (
 	"database/sql"
 	"flag"
 	"fmt"
-	"log"
 	"log/slog"
-	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	_ "github.com/lib/pq"
 
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/agents"
 	"github.com/tanvir-rifat007/codegen-ai-react/internal/data"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/janitor"
 	"github.com/tanvir-rifat007/codegen-ai-react/internal/mailer"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/runner"
 	"github.com/tanvir-rifat007/codegen-ai-react/internal/server"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/storage"
 )
 
 var (
@@ -29,10 +32,46 @@ type config struct {
 	env       string
 	openAiKey string
 	outputDir string
+	models    string
+	block     bool
 	db        struct {
 		dsn string
 	}
-	smtp struct {
+	run struct {
+		timeout time.Duration
+		cpu     time.Duration
+		memory  int64
+		uid     int
+		gid     int
+		network bool
+	}
+	retention struct {
+		maxAge      time.Duration
+		maxSessions int
+		maxDiskMB   int64
+		interval    time.Duration
+	}
+	artifacts struct {
+		store string
+		s3    storage.S3Config
+		// createBucket creates the S3 bucket on startup.
+		createBucket bool
+	}
+	// shutdownTimeout bounds how long a shutdown waits for running
+	// generations.
+	shutdownTimeout time.Duration
+	limiter         struct {
+		enabled bool
+		rps     float64
+		burst   int
+	}
+	cors struct {
+		trustedOrigins []string
+	}
+	// trustProxy takes client addresses from X-Forwarded-For.
+	trustProxy  bool
+	adminEmails []string
+	smtp        struct {
 		host     string
 		port     int
 		username string
@@ -42,11 +81,12 @@ type config struct {
 }
 
 type application struct {
-	config config
-	logger *slog.Logger
-	wg     sync.WaitGroup
-	models data.Models
-	mailer *mailer.Mailer
+	config  config
+	logger  *slog.Logger
+	wg      sync.WaitGroup
+	models  data.Models
+	mailer  *mailer.Mailer
+	janitor *janitor.Janitor
 }
 
 const version = "1.0.0"
@@ -61,8 +101,59 @@ func main() {
 	flag.StringVar(&cfg.openAiKey, "openAiKey", os.Getenv("OPENAI_API_KEY"), "OpenAI API key")
 	flag.StringVar(&cfg.outputDir, "output-dir", "./output", "Base directory for generated projects")
 
+	flag.StringVar(&cfg.models, "models-config", "", "JSON file listing the allowed models (defaults to the built-in catalogue)")
+
+	flag.BoolVar(&cfg.block, "block-unsafe", false, "Withhold downloads of generated projects containing secrets or dangerous commands")
+
 	flag.StringVar(&cfg.db.dsn, "db-url", os.Getenv("DB_URL"), "Database url")
 
+	flag.DurationVar(&cfg.run.timeout, "run-timeout", runner.DefaultLimits.Timeout, "Wall-clock limit for running a generated project's build and tests")
+	flag.DurationVar(&cfg.run.cpu, "run-cpu", runner.DefaultLimits.CPU, "CPU time limit for each build or test command")
+	flag.Int64Var(&cfg.run.memory, "run-memory-mb", runner.DefaultLimits.Memory>>20, "Memory limit in MB for each build or test process")
+	flag.IntVar(&cfg.run.uid, "run-uid", runner.DefaultLimits.UID, "User ID build and test commands run as")
+	flag.IntVar(&cfg.run.gid, "run-gid", runner.DefaultLimits.GID, "Group ID build and test commands run as")
+	flag.BoolVar(&cfg.run.network, "run-network", false, "Allow network access while running build and test commands")
+
+	flag.DurationVar(&cfg.retention.maxAge, "retention-max-age", 7*24*time.Hour, "How long generated sessions are kept (0 keeps them forever)")
+	flag.IntVar(&cfg.retention.maxSessions, "retention-max-sessions", 0, "Sessions kept per user, oldest deleted first (0 for no limit)")
+	flag.Int64Var(&cfg.retention.maxDiskMB, "retention-max-disk-mb", 0, "Disk budget in MB for the output directory (0 for no limit)")
+	flag.DurationVar(&cfg.retention.interval, "janitor-interval", time.Hour, "How often expired sessions are deleted")
+
+	flag.StringVar(&cfg.artifacts.store, "artifact-store", "local", "Where generated projects are kept (local | s3)")
+	flag.StringVar(&cfg.artifacts.s3.Endpoint, "s3-endpoint", os.Getenv("S3_ENDPOINT"), "S3 endpoint URL, e.g. http://localhost:9000 for MinIO")
+	flag.StringVar(&cfg.artifacts.s3.Region, "s3-region", "us-east-1", "S3 region")
+	flag.StringVar(&cfg.artifacts.s3.Bucket, "s3-bucket", os.Getenv("S3_BUCKET"), "S3 bucket for generated projects")
+	flag.StringVar(&cfg.artifacts.s3.AccessKey, "s3-access-key", os.Getenv("S3_ACCESS_KEY"), "S3 access key")
+	flag.StringVar(&cfg.artifacts.s3.SecretKey, "s3-secret-key", os.Getenv("S3_SECRET_KEY"), "S3 secret key")
+	flag.BoolVar(&cfg.artifacts.s3.PathStyle, "s3-path-style", false, "Use path-style bucket addressing (needed for MinIO)")
+	flag.StringVar(&cfg.artifacts.s3.Prefix, "s3-prefix", "", "Key prefix for objects in the S3 bucket")
+	flag.BoolVar(&cfg.artifacts.createBucket, "s3-create-bucket", false, "Create the S3 bucket on startup if it doesn't exist")
+
+	flag.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 2*time.Minute, "How long a shutdown waits for running generations")
+
+	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Limit the requests per client IP")
+	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 10, "Requests per second allowed per client IP")
+	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 20, "Burst of requests allowed per client IP")
+	flag.BoolVar(&cfg.trustProxy, "trust-proxy", false, "Take client IPs from the X-Forwarded-For header set by a proxy in front of the server")
+
+	flag.Func("cors-trusted-origins", "Comma separated origins allowed to call the API from a browser", func(val string) error {
+		for _, origin := range strings.Split(val, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				cfg.cors.trustedOrigins = append(cfg.cors.trustedOrigins, origin)
+			}
+		}
+		return nil
+	})
+
+	flag.Func("admin-emails", "Comma separated emails of users allowed to use the admin endpoints", func(val string) error {
+		for _, email := range strings.Split(val, ",") {
+			if email = strings.TrimSpace(email); email != "" {
+				cfg.adminEmails = append(cfg.adminEmails, strings.ToLower(email))
+			}
+		}
+		return nil
+	})
+
 	flag.StringVar(&cfg.smtp.host, "smtp-host", os.Getenv("FROM_EMAIL_SMTP"), "SMTP host")
 	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
 	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("FROM_EMAIL"), "SMTP username")
@@ -73,6 +164,13 @@ func main() {
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
+	if cfg.models != "" {
+		if err := agents.LoadModelCatalogue(cfg.models); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
 	db, err := openDB(cfg)
 
 	if err != nil {
@@ -84,9 +182,30 @@ func main() {
 
 	logger.Info("Database connection pool established!")
 
+	codegens := &data.CodeGenModel{DB: db}
+
 	// web socket server
-	srv := server.NewServer(cfg.openAiKey, cfg.outputDir, &data.CodeGenModel{
-		DB: db,
+	srv := server.NewServer(cfg.openAiKey, cfg.outputDir, codegens)
+	srv.SetVersion(version)
+
+	if cfg.artifacts.store != "local" {
+		store, err := openArtifactStore(cfg)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		srv.SetArtifactStore(store)
+		logger.Info("Artifact store configured", "store", cfg.artifacts.store, "bucket", cfg.artifacts.s3.Bucket)
+	}
+
+	srv.SetBlockUnsafe(cfg.block)
+	srv.SetRunLimits(runner.Limits{
+		Timeout: cfg.run.timeout,
+		CPU:     cfg.run.cpu,
+		Memory:  cfg.run.memory << 20,
+		UID:     cfg.run.uid,
+		GID:     cfg.run.gid,
+		Network: cfg.run.network,
 	})
 
 	mailer, err := mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender)
@@ -100,45 +219,36 @@ func main() {
 		logger: logger,
 		models: data.NewModels(db),
 		mailer: mailer,
+		janitor: janitor.New(srv.ArtifactStore(), janitor.Policy{
+			MaxAge:             cfg.retention.maxAge,
+			MaxSessionsPerUser: cfg.retention.maxSessions,
+			MaxTotalBytes:      cfg.retention.maxDiskMB << 20,
+		}, codegens),
+	}
+
+	// With a remote store the output directory only holds working
+	// directories, which crashed generations leave behind.
+	if cfg.artifacts.store != "local" {
+		app.janitor.SetWorkDir(cfg.outputDir, srv.Running)
 	}
 
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	go app.janitor.Run(janitorCtx, cfg.retention.interval)
+
 	err = app.initializeApp()
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
 
-	http.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(http.Dir("dist/assets/"))))
-	// Setup HTTP routes
-	http.HandleFunc("/", app.handleSSR)
-
-	http.Handle("/api/health", app.AuthMiddleware(http.HandlerFunc(app.healthcheckHandler)))
-
-	http.HandleFunc("/api/users", app.createUserHandler)
-
-	http.HandleFunc("/api/users/authenticate", app.loginUserHandler)
-
-	http.HandleFunc("/api/users/me", app.meHandler)
-
-	http.HandleFunc("/api/users/logout", app.logoutHandler)
-	http.Handle("/api/generate", app.AuthMiddleware(http.HandlerFunc(srv.HandleGenerate)))
-	http.HandleFunc("/download/", srv.HandleDownload)
-
-	http.HandleFunc("/api/generate-http", srv.HandleGenerateHTTP)
-	http.HandleFunc("/api/activate", app.activateUserHandler)
-
-	// password reset and update handler
-	http.HandleFunc("/api/tokens/password-reset", app.createPasswordResetTokenHandler)
-	http.HandleFunc("/api/users/password", app.updateUserPasswordHandler)
-
-	http.HandleFunc("/api/history", srv.HandleGetUserHistory)
-
-	fmt.Println("SSR Server starting on http://localhost:3000")
+	fmt.Printf("SSR Server starting on http://localhost:%d\n", cfg.port)
 	fmt.Println("Static files served from /assets/")
 	fmt.Println("React SSR on every request!")
 
-	log.Fatal(http.ListenAndServe(":3000", nil))
-
+	if err := app.serve(app.routes(srv), srv, stopJanitor); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
 }
 
 func openDB(cfg config) (*sql.DB, error) {
@@ -164,3 +274,26 @@ func openDB(cfg config) (*sql.DB, error) {
 	return db, nil
 
 }
+
+func openArtifactStore(cfg config) (storage.ArtifactStore, error) {
+	switch cfg.artifacts.store {
+	case "s3":
+		store, err := storage.NewS3(cfg.artifacts.s3, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if cfg.artifacts.createBucket {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			if err := store.CreateBucket(ctx); err != nil {
+				return nil, fmt.Errorf("creating bucket %s: %w", cfg.artifacts.s3.Bucket, err)
+			}
+		}
+
+		return store, nil
+	}
+
+	return nil, fmt.Errorf("unknown artifact store %q (expected local or s3)", cfg.artifacts.store)
+}
@@ -1,26 +1,274 @@
 package main
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"golang.org/x/time/rate"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/requestid"
 	"github.com/tanvir-rifat007/codegen-ai-react/internal/token"
 )
 
+// middleware wraps a handler with behaviour shared by many routes.
+type middleware func(http.Handler) http.Handler
+
+// chain wraps h in the given middleware; the first one sees requests first.
+func chain(h http.Handler, mw ...middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// recoverPanic turns a panicking handler into a 500 response instead of a
+// dropped connection.
+func (app *application) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				w.Header().Set("Connection", "close")
+				app.serverErrorResponse(w, r, fmt.Errorf("%v", err))
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestID gives every request an ID, taken from the X-Request-ID header
+// when a proxy already set one, and sends it back in the response.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestid.FromHeader(r)
+		w.Header().Set(requestid.Header, id)
+
+		next.ServeHTTP(w, requestid.ContextSet(r, id))
+	})
+}
+
+// responseRecorder records the status and size of a response for the access
+// log. It passes flushes and hijacks through, which Server-Sent Events and
+// WebSockets need.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+func (rec *responseRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking is not supported")
+	}
+	rec.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// logRequest writes a structured access log line for every request.
+func (app *application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		app.logger.Info("request",
+			"method", r.Method,
+			"uri", r.URL.RequestURI(),
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration", time.Since(start),
+			"ip", app.clientIP(r),
+			"request_id", requestid.ContextGet(r),
+		)
+	})
+}
+
+// enableCORS lets the origins in -cors-trusted-origins call the API with
+// the user's cookies, and answers their preflight requests.
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+		if origin != "" && slices.Contains(app.config.cors.trustedOrigins, origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Set("Access-Control-Expose-Headers", requestid.Header)
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PUT, DELETE")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Last-Event-ID, "+requestid.Header)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the address of the client, as seen by the proxy in front
+// of the server when -trust-proxy is set.
+func (app *application) clientIP(r *http.Request) string {
+	if app.config.trustProxy {
+		forwarded := r.Header.Values("X-Forwarded-For")
+		if len(forwarded) > 0 {
+			// The last address was added by our proxy; earlier ones come
+			// from the client and can't be trusted.
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// rateLimit limits the requests per client IP to -limiter-rps, with bursts
+// of -limiter-burst.
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	if !app.config.limiter.enabled {
+		return next
+	}
+
+	type client struct {
+		limiter  *rate.Limiter
+		lastSeen time.Time
+	}
+
+	var (
+		mu      sync.Mutex
+		clients = make(map[string]*client)
+	)
+
+	// Forget clients that have been quiet for a while.
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+
+			mu.Lock()
+			for ip, c := range clients {
+				if time.Since(c.lastSeen) > 3*time.Minute {
+					delete(clients, ip)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := app.clientIP(r)
+
+		mu.Lock()
+		c, ok := clients[ip]
+		if !ok {
+			c = &client{limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst)}
+			clients[ip] = c
+		}
+		c.lastSeen = time.Now()
+		allowed := c.limiter.Allow()
+		mu.Unlock()
+
+		if !allowed {
+			app.rateLimitExceededResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		jwtString, err := token.GetAuthCookie(r)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			app.unAuthorizedCredentialsResponse(w, r)
 			return
 		}
 
 		parsedToken, err := token.ValidateJWT(jwtString, app.logger)
 		if err != nil || !parsedToken.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		user, ok := token.UserFromClaims(parsedToken)
+		if !ok {
+			app.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 
 		//Token valid, continue
+		next.ServeHTTP(w, token.ContextSetUser(r, user))
+	})
+}
+
+// requireAdmin only lets users listed in -admin-emails through. It must be
+// wrapped by AuthMiddleware.
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := token.ContextGetUser(r)
+		if !ok {
+			app.unAuthorizedCredentialsResponse(w, r)
+			return
+		}
+
+		if !slices.Contains(app.config.adminEmails, strings.ToLower(user.Email)) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/agents"
+)
+
+// listModelsHandler returns the models generation requests may use, with
+// their limits, pricing and capabilities.
+func (app *application) listModelsHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"models": agents.ListModels()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/server"
+)
+
+// router registers method-aware routes on a ServeMux. Requests no route
+// matches get the API's JSON errors instead of the mux's plain text ones: a
+// 405 listing the allowed methods when the path is known, a 404 otherwise.
+type router struct {
+	app *application
+	mux *http.ServeMux
+	// methods are the methods routes were registered for.
+	methods []string
+	// catchAll are the patterns serving whole subtrees, which don't make a
+	// path known.
+	catchAll map[string]bool
+}
+
+func newRouter(app *application) *router {
+	return &router{
+		app:      app,
+		mux:      http.NewServeMux(),
+		catchAll: make(map[string]bool),
+	}
+}
+
+// handle serves method requests for path, a ServeMux path pattern, with h
+// wrapped in mw.
+func (rt *router) handle(method, path string, h http.Handler, mw ...middleware) {
+	rt.mux.Handle(method+" "+path, chain(h, mw...))
+	if !slices.Contains(rt.methods, method) {
+		rt.methods = append(rt.methods, method)
+	}
+}
+
+func (rt *router) handleFunc(method, path string, h http.HandlerFunc, mw ...middleware) {
+	rt.handle(method, path, h, mw...)
+}
+
+// handleSubtree is handle for a pattern ending in a slash that serves
+// whatever no other route matches below it.
+func (rt *router) handleSubtree(method, path string, h http.Handler) {
+	rt.handle(method, path, h)
+	rt.catchAll[method+" "+path] = true
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, pattern := rt.mux.Handler(r); pattern != "" {
+		rt.mux.ServeHTTP(w, r)
+		return
+	}
+
+	if allowed := rt.allowed(r); len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		rt.app.methodNotAllowedResponse(w, r)
+		return
+	}
+
+	rt.app.notFoundResponse(w, r)
+}
+
+// allowed lists the methods routes serve r's path with.
+func (rt *router) allowed(r *http.Request) []string {
+	var allowed []string
+
+	for _, method := range rt.methods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+
+		if _, pattern := rt.mux.Handler(probe); pattern != "" && !rt.catchAll[pattern] {
+			allowed = append(allowed, method)
+			if method == http.MethodGet {
+				allowed = append(allowed, http.MethodHead)
+			}
+		}
+	}
+
+	return allowed
+}
+
+// routes returns the API's handler: every route wrapped in the middleware
+// shared by all requests.
+func (app *application) routes(srv *server.Server) http.Handler {
+	rt := newRouter(app)
+
+	auth := app.AuthMiddleware
+	admin := app.requireAdmin
+
+	rt.handleSubtree(http.MethodGet, "/assets/", http.StripPrefix("/assets/", http.FileServer(http.Dir("dist/assets/"))))
+	// The React app renders every other page.
+	rt.handleSubtree(http.MethodGet, "/", http.HandlerFunc(app.handleSSR))
+	// Unknown API paths get a JSON 404 rather than the React app.
+	rt.handleSubtree(http.MethodGet, "/api/", http.HandlerFunc(app.notFoundResponse))
+
+	rt.handleFunc(http.MethodGet, "/api/health", app.healthcheckHandler, auth)
+	rt.handleFunc(http.MethodGet, "/api/models", app.listModelsHandler)
+
+	rt.handleFunc(http.MethodPost, "/api/users", app.createUserHandler)
+	rt.handleFunc(http.MethodPost, "/api/users/authenticate", app.loginUserHandler)
+	rt.handleFunc(http.MethodGet, "/api/users/me", app.meHandler)
+	rt.handleFunc(http.MethodPost, "/api/users/logout", app.logoutHandler)
+	rt.handleFunc(http.MethodPut, "/api/users/password", app.updateUserPasswordHandler)
+	// Activation links are opened from the welcome email.
+	rt.handleFunc(http.MethodGet, "/api/activate", app.activateUserHandler)
+	rt.handleFunc(http.MethodPost, "/api/tokens/password-reset", app.createPasswordResetTokenHandler)
+
+	// WebSocket upgrades are GET requests.
+	rt.handleFunc(http.MethodGet, "/api/generate", srv.HandleGenerate, auth)
+	rt.handleFunc(http.MethodPost, "/api/generate-http", srv.HandleGenerateHTTP, auth)
+	rt.handleFunc(http.MethodGet, "/api/history", srv.HandleGetUserHistory, auth)
+	rt.handleFunc(http.MethodGet, "/download/{id}", srv.HandleDownload, auth)
+
+	rt.handleFunc(http.MethodGet, "/api/sessions/{id}/tree", srv.HandleSessionTree, auth)
+	rt.handleFunc(http.MethodGet, "/api/sessions/{id}/files/{path...}", srv.HandleSessionFile, auth)
+	rt.handleFunc(http.MethodGet, "/api/sessions/{id}/events", srv.HandleSessionEvents, auth)
+
+	rt.handleFunc(http.MethodGet, "/api/admin/janitor", app.janitorReportHandler, auth, admin)
+
+	return chain(rt, app.recoverPanic, app.requestID, app.logRequest, app.enableCORS, app.rateLimit)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/data"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/server"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/token"
+)
+
+// codeGens is a CodeGenStore holding a fixed set of generations.
+type codeGens []*data.CodenGen
+
+func (c codeGens) Create(*data.CodenGen) error       { return nil }
+func (c codeGens) UpdateStatus(*data.CodenGen) error { return nil }
+func (c codeGens) AppendEvent(*data.Event) error     { return nil }
+
+func (c codeGens) GetBySessionID(sessionID string) (*data.CodenGen, error) {
+	for _, cg := range c {
+		if cg.SessionID == sessionID {
+			return cg, nil
+		}
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func (c codeGens) GetAllByUserID(userID int) ([]*data.CodenGen, error) {
+	var owned []*data.CodenGen
+	for _, cg := range c {
+		if cg.UserID == userID {
+			owned = append(owned, cg)
+		}
+	}
+	return owned, nil
+}
+
+func (c codeGens) MarkInterrupted([]string) (int64, error) { return 0, nil }
+
+func (c codeGens) EventsAfter(string, int64) ([]data.Event, error) { return nil, nil }
+
+func TestRoutes(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	app := &application{logger: logger}
+	srv := server.NewServer("", t.TempDir(), codeGens{
+		{UserID: 1, SessionID: "mine", Status: "complete"},
+		{UserID: 2, SessionID: "theirs", Status: "complete"},
+	})
+	h := app.routes(srv)
+
+	cookie := &http.Cookie{
+		Name:  token.CookieName,
+		Value: token.CreateJWT(data.User{ID: "1", Email: "ada@example.com", Activated: true}, logger),
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		signedIn   bool
+		wantStatus int
+		wantCode   string
+		wantAllow  string
+	}{
+		{"unknown api path", http.MethodGet, "/api/nope", false, http.StatusNotFound, "not_found", ""},
+		{"wrong method", http.MethodDelete, "/api/users", false, http.StatusMethodNotAllowed, "method_not_allowed", "POST"},
+		{"wrong method on a GET route", http.MethodPost, "/api/history", false, http.StatusMethodNotAllowed, "method_not_allowed", "GET, HEAD"},
+		{"wrong method below a catch-all", http.MethodPost, "/dashboard", false, http.StatusNotFound, "not_found", ""},
+		{"history signed out", http.MethodGet, "/api/history", false, http.StatusUnauthorized, "unauthorized", ""},
+		{"download signed out", http.MethodGet, "/download/mine", false, http.StatusUnauthorized, "unauthorized", ""},
+		{"download of another user's session", http.MethodGet, "/download/theirs", true, http.StatusForbidden, "forbidden", ""},
+		{"download of an unknown session", http.MethodGet, "/download/missing", true, http.StatusNotFound, "not_found", ""},
+		{"admin route for a non-admin", http.MethodGet, "/api/admin/janitor", true, http.StatusForbidden, "forbidden", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.signedIn {
+				r.AddCookie(cookie)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := w.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+
+			var body struct {
+				Code string `json:"code"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q is not JSON: %v", w.Body, err)
+			}
+			if body.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", body.Code, tt.wantCode)
+			}
+		})
+	}
+
+	t.Run("history lists the signed in user's generations", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/history", nil)
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d; body %s", w.Code, http.StatusOK, w.Body)
+		}
+
+		var history []data.CodenGen
+		if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 1 || history[0].SessionID != "mine" {
+			t.Errorf("history = %+v, want only session mine", history)
+		}
+	})
+}
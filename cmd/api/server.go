@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/server"
+)
+
+// Shutdown phases beyond the shutdown timeout, each with its own deadline.
+const (
+	// requestGrace is how much longer than the generations the remaining
+	// requests get, so interrupted generations can still answer them.
+	requestGrace = 10 * time.Second
+	// backgroundTimeout bounds the wait for background tasks such as
+	// emails once no request can start more of them.
+	backgroundTimeout = 30 * time.Second
+)
+
+// serve runs the HTTP server until SIGINT or SIGTERM, then drains it: new
+// generations are refused, connected clients are told, and running
+// generations are waited for until the shutdown timeout while the HTTP
+// server shuts down alongside. Background emails get their own deadline
+// afterwards. The janitor is stopped by cancelling stopJanitor.
+func (app *application) serve(handler http.Handler, generations *server.Server, stopJanitor context.CancelFunc) error {
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", app.config.port),
+		Handler:           handler,
+		IdleTimeout:       time.Minute,
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+	}
+
+	shutdownError := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+
+		app.logger.Info("shutting down server", "signal", s.String(), "timeout", app.config.shutdownTimeout)
+
+		stopJanitor()
+
+		// Generation requests keep the HTTP server busy, so it shuts down
+		// while they drain rather than after.
+		drainErr := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), app.config.shutdownTimeout)
+			defer cancel()
+			drainErr <- generations.Drain(ctx)
+		}()
+
+		var errs []error
+
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.shutdownTimeout+requestGrace)
+		if err := srv.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+			srv.Close()
+		}
+		cancel()
+
+		if err := <-drainErr; err != nil {
+			errs = append(errs, err)
+		}
+
+		app.logger.Info("completing background tasks", "addr", srv.Addr, "timeout", backgroundTimeout)
+
+		if err := app.waitBackground(backgroundTimeout); err != nil {
+			errs = append(errs, err)
+		}
+
+		shutdownError <- errors.Join(errs...)
+	}()
+
+	app.logger.Info("starting server", "addr", srv.Addr, "env", app.config.env)
+
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	if err := <-shutdownError; err != nil {
+		return err
+	}
+
+	app.logger.Info("stopped server", "addr", srv.Addr)
+	return nil
+}
+
+// waitBackground waits for the tasks started by background for at most
+// timeout.
+func (app *application) waitBackground(timeout time.Duration) error {
+	done := make(chan struct{})
+	go func() {
+		app.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("background tasks still running after %s", timeout)
+	}
+}
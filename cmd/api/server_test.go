@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWaitBackground(t *testing.T) {
+	app := &application{}
+
+	release := make(chan struct{})
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		<-release
+	}()
+
+	start := time.Now()
+	if err := app.waitBackground(50 * time.Millisecond); err == nil {
+		t.Fatal("waitBackground returned nil with a task still running")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("waitBackground took %s, want about 50ms", elapsed)
+	}
+
+	close(release)
+	if err := app.waitBackground(time.Second); err != nil {
+		t.Errorf("waitBackground after the task finished: %v", err)
+	}
+}
@@ -202,21 +202,21 @@ func (app *application) meHandler(w http.ResponseWriter, r *http.Request) {
 	jwtStr, err := token.GetAuthCookie(r)
 
 	if err != nil {
-		app.logger.Error(err.Error())
+		app.unAuthorizedCredentialsResponse(w, r)
 		return
 	}
 
 	parsed, err := token.ValidateJWT(jwtStr, app.logger)
 
 	if err != nil {
-		app.logger.Error(err.Error())
+		app.invalidAuthenticationTokenResponse(w, r)
 		return
 	}
 
 	claims, ok := parsed.Claims.(jwt.MapClaims)
 
 	if !ok {
-		http.Error(w, "Invalid Claims", http.StatusUnauthorized)
+		app.invalidAuthenticationTokenResponse(w, r)
 		return
 	}
 
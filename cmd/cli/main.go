@@ -7,12 +7,19 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/tanvir-rifat007/codegen-ai-react/internal/agents"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/archive"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/patch"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/server"
 )
 
+// version is recorded as the generator version in project manifests.
+const version = "1.0.0"
+
 func main() {
 
 	openaiKey := flag.String("OPENAI_API_KEY", os.Getenv("OPENAI_API_KEY"), "openai api key")
@@ -23,36 +30,84 @@ func main() {
 	model := flag.String("model", "gpt-4o-mini", "Model name of the openai api")
 
 	templateName := flag.String("template", "go-default", "Project template to use")
-	language := flag.String("language", "go", "Programming language to use")
+	language := flag.String("language", "go", "Programming language to use (the template's language when unset)")
 	timeOut := flag.Int("timeout", 120, "Timeout for openai api response")
 	listTemplates := flag.Bool("list-templates", false, "List available templates and exit")
+	listModels := flag.Bool("list-models", false, "List available models and exit")
+	modelsConfig := flag.String("models-config", "", "JSON file listing the available models")
 	listLanguages := flag.Bool("list-languages", false, "List supported programming languages and exit")
+	autoFix := flag.Bool("fix", true, "Automatically fix package and import path mismatches in generated Go code")
+	mode := flag.String("mode", "write", "Output mode (write | diff | apply)")
+	contextDir := flag.String("context-dir", "", "Existing project directory to include as context")
+	contextZip := flag.String("context-zip", "", "Zip archive of an existing project to include as context")
+	contextTokens := flag.Int("context-tokens", agents.DefaultContextTokens, "Token budget for context files")
+	planning := flag.Bool("plan", false, "Plan the project first and generate it file by file")
+	repairRounds := flag.Int("repair-rounds", 0, "Rounds of asking the model to fix generated files that fail to parse")
+	providerConcurrency := flag.Int("provider-concurrency", 4, "Maximum concurrent requests to the model provider")
+	withTests := flag.Bool("with-tests", false, "Generate unit tests for every generated source file")
+	protocol := flag.String("protocol", agents.ProtocolDelimited, "How the model returns files (delimited | json | json_schema | tools)")
+	temperature := flag.Float64("temperature", 0, "Sampling temperature (provider default when unset)")
+	topP := flag.Float64("top-p", 0, "Nucleus sampling probability mass (provider default when unset)")
+	maxTokens := flag.Int("max-tokens", 0, "Maximum tokens per response (provider default when unset)")
+	seed := flag.Int64("seed", 0, "Seed for best-effort deterministic sampling")
+	stop := flag.String("stop", "", "Comma separated stop sequences")
+	reasoningEffort := flag.String("reasoning-effort", "", "Reasoning effort for reasoning models (minimal | low | medium | high)")
+	license := flag.String("license", "", "SPDX identifier of the LICENSE added to the project, or none (template default when unset)")
+	licenseHolder := flag.String("license-holder", "", "Copyright holder named in the LICENSE")
+	archiveFormat := flag.String("archive", "", "Also pack the output directory into an archive next to it (zip | tar.gz | tar.zst)")
+	patchFile := flag.String("patch", "", "Patch file written in diff mode, or applied in apply mode instead of generating")
 
 	flag.Parse()
 
-	client := agents.NewOpenAI(context.Background(), *openaiKey, *model, &http.Client{
-		Timeout: time.Duration(*timeOut) * time.Second,
-	})
-
-	agents, err := agents.NewAgent(context.Background(), client, *outputDir, *basePackage, *templateName, *language, *workerCount)
+	if *modelsConfig != "" {
+		if err := agents.LoadModelCatalogue(*modelsConfig); err != nil {
+			log.Printf("Error loading models: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	if err != nil {
-		fmt.Printf("%s\n", err.Error())
+	if *listModels {
+		printModels()
+		return
+	}
 
+	if *mode != "write" && *mode != "diff" && *mode != "apply" {
+		log.Printf("Unknown mode %q, expected write, diff or apply", *mode)
+		os.Exit(1)
 	}
 
-	if *listTemplates {
-		fmt.Println("Available templates:")
-		for _, tmpl := range agents.ListTemplates() {
-			fmt.Printf("- %s: %s (Language: %s)\n", tmpl.Name, tmpl.Description, tmpl.Language)
+	if *mode == "apply" && *patchFile != "" {
+		if err := applyPatchFile(*outputDir, *patchFile); err != nil {
+			log.Printf("Error applying patch: %v\n", err)
+			os.Exit(1)
 		}
 		return
 	}
 
-	// list languages
-	if *listLanguages {
+	agents.SetProviderConcurrency(agents.ProviderOpenAI, *providerConcurrency)
+
+	httpClient := &http.Client{
+		Timeout: time.Duration(*timeOut) * time.Second,
+	}
+
+	client := agents.NewOpenAI(context.Background(), *openaiKey, *model, httpClient)
+	agent, err := agents.NewAgent(context.Background(), client, *outputDir, *basePackage, *templateName, *language, *workerCount)
+	if err != nil {
+		log.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	if *listTemplates || *listLanguages {
+		if *listTemplates {
+			fmt.Println("Available templates:")
+			for _, tmpl := range agent.ListTemplates() {
+				fmt.Printf("- %s: %s (Language: %s)\n", tmpl.Name, tmpl.Description, tmpl.Language)
+			}
+			return
+		}
+
 		fmt.Println("Supported languages:")
-		for _, lang := range agents.ListLanguages() {
+		for _, lang := range agent.ListLanguages() {
 			fmt.Printf("- %s\n", lang)
 		}
 		return
@@ -66,20 +121,223 @@ func main() {
 
 	}
 
-	agents.Start()
+	if *archiveFormat != "" {
+		format, err := archive.ParseFormat(*archiveFormat)
+		if err != nil {
+			log.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		*archiveFormat = format
+	}
+
+	// Requests must match the template's language, so -language only needs
+	// to be given for templates that don't declare one.
+	if !flagSet("language") {
+		if tmpl, ok := agent.Template(); ok && tmpl.Language != "" {
+			*language = tmpl.Language
+		}
+	}
 
 	prompt := strings.Join(args, " ")
 
-	if err = agents.GenerateCode(prompt); err != nil {
+	projectContext, err := loadProjectContext(*contextDir, *contextZip, prompt, *contextTokens)
+	if err != nil {
+		log.Printf("Error loading project context: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Projects are written straight to the output directory and nothing is
+	// recorded.
+	generations := server.NewGenerationService(*openaiKey, *outputDir, nil)
+	generations.SetVersion(version)
+	generations.SetHTTPClient(httpClient)
 
+	gen, err := generations.Run(context.Background(), server.ProjectRequest{
+		Prompt:        prompt,
+		Language:      *language,
+		Template:      *templateName,
+		BasePackage:   *basePackage,
+		WorkerCount:   *workerCount,
+		Model:         *model,
+		Plan:          *planning,
+		RepairRounds:  *repairRounds,
+		WithTests:     *withTests,
+		Protocol:      *protocol,
+		Sampling:      samplingParams(*temperature, *topP, *maxTokens, *seed, *stop, *reasoningEffort),
+		License:       *license,
+		LicenseHolder: *licenseHolder,
+		OutputDir:     *outputDir,
+		DryRun:        *mode != "write",
+		NoAutoFix:     !*autoFix,
+		Context:       projectContext,
+	}, nil)
+	if err != nil {
 		log.Printf("Error writing code : %v\n", err)
-		agents.Stop()
 		os.Exit(1)
+	}
+
+	for _, issue := range gen.Result.Issues {
+		status := "reported"
+		if issue.Fixed {
+			status = "fixed"
+		}
+		fmt.Fprintf(os.Stderr, "[%s] %s: %s (%s)\n", issue.Kind, issue.File, issue.Message, status)
+	}
+
+	for _, finding := range gen.Result.Findings {
+		file := finding.File
+		if file == "" {
+			file = "prompt"
+		}
+		fmt.Fprintf(os.Stderr, "[%s] %s:%d: %s: %s\n", finding.Severity, file, finding.Line, finding.Message, finding.Match)
+	}
+
+	if *mode == "write" {
+		if *archiveFormat != "" {
+			archivePath := filepath.Clean(*outputDir) + archive.Extension(*archiveFormat)
+			if err := archive.WriteFile(archivePath, *archiveFormat, *outputDir); err != nil {
+				log.Printf("Error writing archive: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println("Wrote", archivePath)
+		}
+		return
+	}
+
+	diffs, err := patch.Compare(*outputDir, gen.Contents)
+	if err != nil {
+		log.Printf("Error comparing with %s: %v\n", *outputDir, err)
+		os.Exit(1)
+	}
+
+	if len(diffs) == 0 {
+		fmt.Println("No changes against", *outputDir)
+		return
+	}
+
+	if *mode == "diff" {
+		if err := writePatch(patch.Format(diffs), *patchFile); err != nil {
+			log.Printf("Error writing patch: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := applyDiffs(*outputDir, diffs); err != nil {
+		log.Printf("Error applying changes: %v\n", err)
+		os.Exit(1)
+	}
+}
 
+func printModels() {
+	fmt.Println("Available models:")
+	for _, m := range agents.ListModels() {
+		var caps []string
+		if m.JSONMode {
+			caps = append(caps, "json")
+		}
+		if m.Streaming {
+			caps = append(caps, "streaming")
+		}
+		if m.Reasoning {
+			caps = append(caps, "reasoning")
+		}
+		fmt.Printf("- %s (%s): %d context, %d output tokens, $%.2f/$%.2f per 1M tokens in/out [%s]\n",
+			m.Name, m.Provider, m.ContextWindow, m.MaxOutputTokens,
+			m.Pricing.InputPerMillion, m.Pricing.OutputPerMillion, strings.Join(caps, ", "))
 	}
+}
 
-	time.Sleep(1 * time.Second)
+// flagSet reports whether the named flag was set on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
 
-	agents.Stop()
+// samplingParams builds sampling parameters from the flags that were set on
+// the command line, leaving the rest to the template and provider defaults.
+func samplingParams(temperature, topP float64, maxTokens int, seed int64, stop, reasoningEffort string) agents.SamplingParams {
+	var p agents.SamplingParams
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "temperature":
+			p.Temperature = &temperature
+		case "top-p":
+			p.TopP = &topP
+		case "max-tokens":
+			p.MaxTokens = &maxTokens
+		case "seed":
+			p.Seed = &seed
+		case "stop":
+			for _, s := range strings.Split(stop, ",") {
+				if s != "" {
+					p.Stop = append(p.Stop, s)
+				}
+			}
+		case "reasoning-effort":
+			p.ReasoningEffort = reasoningEffort
+		}
+	})
+
+	return p
+}
 
+func loadProjectContext(dir, zipPath, prompt string, tokens int) (*agents.ProjectContext, error) {
+	switch {
+	case dir != "":
+		return agents.LoadContextDir(dir, prompt, tokens)
+	case zipPath != "":
+		data, err := os.ReadFile(zipPath)
+		if err != nil {
+			return nil, err
+		}
+		return agents.LoadContextZip(data, prompt, tokens)
+	}
+	return nil, nil
+}
+
+func writePatch(contents, patchFile string) error {
+	if patchFile == "" {
+		_, err := fmt.Print(contents)
+		return err
+	}
+
+	if err := os.WriteFile(patchFile, []byte(contents), 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Patch written to %s\n", patchFile)
+	return nil
+}
+
+func applyPatchFile(outputDir, patchFile string) error {
+	contents, err := os.ReadFile(patchFile)
+	if err != nil {
+		return err
+	}
+
+	diffs, err := patch.Parse(string(contents))
+	if err != nil {
+		return err
+	}
+
+	return applyDiffs(outputDir, diffs)
+}
+
+func applyDiffs(outputDir string, diffs []*patch.FileDiff) error {
+	written, err := patch.Apply(outputDir, diffs)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range written {
+		fmt.Printf("Updated %s\n", p)
+	}
+	return nil
 }
@@ -6,10 +6,12 @@ require (
 	github.com/golang-jwt/jwt/v5 v5.3.0
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.3
+	github.com/klauspost/compress v1.18.0
 	github.com/lib/pq v1.10.9
 	github.com/mark3labs/mcp-go v0.40.0
 	github.com/wneessen/go-mail v0.7.0
 	golang.org/x/crypto v0.42.0
+	golang.org/x/time v0.11.0
 	rogchap.com/v8go v0.9.0
 )
 
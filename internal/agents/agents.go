@@ -12,6 +12,8 @@ import (
 	"strings"
 	"sync"
 	"text/template"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/guard"
 )
 
 //go:embed templates/*
@@ -26,8 +28,26 @@ type ProjectTemplate struct {
 	Name        string            `json:"name"`
 	Description string            `json:"description"`
 	Language    string            `json:"language"`
+	Version     string            `json:"version,omitempty"`
 	Prompt      string            `json:"prompt"`
 	Files       map[string]string `json:"files"`
+
+	PostProcessors []PostProcessorSpec `json:"postProcessors,omitempty"`
+
+	// Deps, Build and Test are shell commands run in the generated project
+	// to fetch its dependencies and check that it builds and its tests
+	// pass. Only Deps may reach the network.
+	Deps  []string `json:"deps,omitempty"`
+	Build []string `json:"build,omitempty"`
+	Test  []string `json:"test,omitempty"`
+
+	// Sampling holds default sampling parameters for requests made with
+	// this template.
+	Sampling *SamplingParams `json:"sampling,omitempty"`
+
+	// License is the SPDX identifier of the license added to generated
+	// projects unless the request picks another one.
+	License string `json:"license,omitempty"`
 }
 
 type PromptTemplate struct {
@@ -40,18 +60,36 @@ type Agent struct {
 	openAI           *OpenAPI
 	outputDir        string
 	basePackage      string
-	taskQueue        chan FileTask
+	unitQueue        chan unitJob
+	stopOnce         sync.Once
 	wg               sync.WaitGroup
 	workerCount      int
 	ctx              context.Context
 	cancel           context.CancelFunc
 	fileWriterMutex  sync.Mutex
 	filesWritten     map[string]bool
+	files            map[string]string
 	selectedTmpl     string
 	language         string
 	templates        map[string]ProjectTemplate
 	promptTmpls      map[string]PromptTemplate
 	progressCallback ProgressCallback
+	pipeline         []namedProcessor
+	modulePath       string
+	autoFix          bool
+	dryRun           bool
+	projectContext   *ProjectContext
+	planning         bool
+	plan             *Plan
+	repairRounds     int
+	withTests        bool
+	tests            []string
+	protocol         string
+	sampling         SamplingParams
+	promptFindings   []guard.Finding
+	license          string
+	licenseHolder    string
+	promptHash       string
 }
 
 var (
@@ -89,11 +127,13 @@ func NewAgent(ctx context.Context,
 		openAI:       openAI,
 		outputDir:    outputDir,
 		basePackage:  basePackage,
-		taskQueue:    make(chan FileTask, 100),
+		unitQueue:    make(chan unitJob),
 		workerCount:  workerCount,
 		ctx:          ctx,
 		cancel:       cancel,
 		filesWritten: make(map[string]bool),
+		files:        make(map[string]string),
+		autoFix:      true,
 		selectedTmpl: templateName,
 		language:     language,
 	}
@@ -116,37 +156,25 @@ func (a *Agent) Start() {
 	}
 }
 
+// worker executes generation units until the unit queue is closed.
 func (a *Agent) worker(id int) {
 	defer a.wg.Done()
 
 	log.Printf("Worker %d started\n", id)
 	for {
 		select {
-		case task, ok := <-a.taskQueue:
+		case job, ok := <-a.unitQueue:
 			if !ok {
 				log.Printf("Worker %d stopping\n", id)
 				return
 			}
-			if a.progressCallback != nil {
-				a.progressCallback("file", "writing file", task.Path)
-			}
 
-			a.fileWriterMutex.Lock()
-			if a.filesWritten[task.Path] {
-				log.Printf("File %s already written, skipping\n", task.Path)
-				a.fileWriterMutex.Unlock()
-				continue
-			}
-
-			a.filesWritten[task.Path] = true
-			a.fileWriterMutex.Unlock()
-
-			err := a.writeFile(task)
+			log.Printf("Worker %d running unit %s\n", id, job.unit.name)
+			tasks, err := job.unit.run(a.ctx)
 			if err != nil {
-				log.Printf("Error writing file (worker %d) %s: %v\n", id, task.Path, err)
-			} else {
-				log.Printf("Worker %d wrote file %s\n", id, task.Path)
+				log.Printf("Error running unit (worker %d) %s: %v\n", id, job.unit.name, err)
 			}
+			job.done(unitResult{tasks: tasks, err: err})
 
 		case <-a.ctx.Done():
 			log.Printf("Worker %d received cancel signal", id)
@@ -156,7 +184,48 @@ func (a *Agent) worker(id int) {
 	}
 }
 
+// MessageWritingFile is the progress message reported for every file
+// written.
+const MessageWritingFile = "writing file"
+
+// emitFile writes a generated file unless a file with the same path has
+// already been written.
+func (a *Agent) emitFile(task FileTask) {
+	a.emit(task, "file")
+}
+
+// emit writes a file like emitFile, reporting it with the given progress
+// event type.
+func (a *Agent) emit(task FileTask, eventType string) {
+	a.fileWriterMutex.Lock()
+	if a.filesWritten[task.Path] {
+		log.Printf("File %s already written, skipping\n", task.Path)
+		a.fileWriterMutex.Unlock()
+		return
+	}
+
+	a.filesWritten[task.Path] = true
+	a.fileWriterMutex.Unlock()
+
+	if a.progressCallback != nil {
+		a.progressCallback(eventType, MessageWritingFile, task.Path)
+	}
+
+	if err := a.writeFile(task); err != nil {
+		log.Printf("Error writing file %s: %v\n", task.Path, err)
+	}
+}
+
 func (a *Agent) writeFile(task FileTask) error {
+	content := a.postProcess(task.Path, task.Content)
+
+	a.fileWriterMutex.Lock()
+	a.files[task.Path] = content
+	a.fileWriterMutex.Unlock()
+
+	if a.dryRun {
+		return nil
+	}
 
 	fullPath := filepath.Join(a.outputDir, task.Path)
 
@@ -167,7 +236,7 @@ func (a *Agent) writeFile(task FileTask) error {
 		return fmt.Errorf("error creating directories: %s: %w", dir, err)
 	}
 
-	err := os.WriteFile(fullPath, []byte(task.Content), 0644)
+	err := os.WriteFile(fullPath, []byte(content), 0644)
 	if err != nil {
 		return fmt.Errorf("error writing file %s: %w", fullPath, err)
 	}
@@ -178,21 +247,85 @@ func (a *Agent) writeFile(task FileTask) error {
 }
 
 func (a *Agent) SendFileTask(path, content string) {
-	task := FileTask{
+	a.emitFile(FileTask{
 		Path:    path,
 		Content: content,
-	}
-
-	go func() {
-		a.taskQueue <- task
-	}()
+	})
 }
 
 func (a *Agent) Stop() {
 	log.Println("Stopping agent...")
-	close(a.taskQueue)
-	a.cancel()
+	a.stopOnce.Do(func() {
+		close(a.unitQueue)
+	})
 	a.wg.Wait()
+	a.cancel()
+}
+
+// SetAutoFix controls whether the post-write analyzers rewrite the problems
+// they find or only report them.
+func (a *Agent) SetAutoFix(autoFix bool) {
+	a.autoFix = autoFix
+}
+
+// SetProjectContext includes files from an existing project in the prompt.
+func (a *Agent) SetProjectContext(pc *ProjectContext) {
+	a.projectContext = pc
+}
+
+// SetPlanning switches GenerateCode to plan the project first and then
+// generate each planned file with a separate model call.
+func (a *Agent) SetPlanning(planning bool) {
+	a.planning = planning
+}
+
+// SetDryRun keeps generated files in memory instead of writing them to the
+// output directory. They can be read back with Files.
+func (a *Agent) SetDryRun(dryRun bool) {
+	a.dryRun = dryRun
+}
+
+// Files returns the final content of every generated file keyed by its path
+// relative to the output directory.
+func (a *Agent) Files() map[string]string {
+	a.fileWriterMutex.Lock()
+	defer a.fileWriterMutex.Unlock()
+
+	files := make(map[string]string, len(a.files))
+	for p, content := range a.files {
+		files[p] = content
+	}
+	return files
+}
+
+// Usage returns the model requests and tokens the agent has used so far.
+func (a *Agent) Usage() Usage {
+	return a.openAI.Usage()
+}
+
+// Finish waits for every queued file to be written, stops the workers and
+// runs the post-write analyzers over the generated files.
+func (a *Agent) Finish() *GenerationResult {
+	a.Stop()
+
+	result := &GenerationResult{
+		Files: sortedKeys(a.files),
+		Plan:  a.plan,
+		Tests: a.tests,
+
+		Protocol: a.Protocol(),
+		Sampling: a.Sampling(),
+		Usage:    a.Usage(),
+	}
+
+	if a.language == "go" {
+		result.Issues = a.analyzeGo(a.autoFix)
+	}
+
+	result.Findings = append(result.Findings, a.promptFindings...)
+	result.Findings = append(result.Findings, guard.ScanFiles(a.Files())...)
+
+	return result
 }
 
 func (a *Agent) loadTemplates() error {
@@ -358,10 +491,60 @@ func (a *Agent) processTemplate(content string) (string, error) {
 }
 
 func (a *Agent) GenerateCode(prompt string) error {
+	a.promptHash = hashContent(prompt)
+
+	formattedSystemPrompt, err := a.prepare()
+	if err != nil {
+		return err
+	}
+
+	if a.projectContext != nil && len(a.projectContext.Files) > 0 {
+		if a.progressCallback != nil {
+			msg := fmt.Sprintf("Including %d existing files (~%d tokens) as context", len(a.projectContext.Files), a.projectContext.Tokens)
+			if a.projectContext.Truncated {
+				msg += "; the project was too large to read entirely"
+			}
+			a.progressCallback("context", msg, "")
+		}
+		prompt += a.projectContext.Prompt()
+	}
+
+	prompt, a.promptFindings = guard.RedactPrompt(prompt)
+	if len(a.promptFindings) > 0 && a.progressCallback != nil {
+		a.progressCallback("guard", fmt.Sprintf("Found %d secret(s) or suspicious instruction(s) in the prompt; secrets were redacted", len(a.promptFindings)), "")
+	}
+
+	if a.planning {
+		if err := a.generatePlanned(formattedSystemPrompt, prompt); err != nil {
+			return err
+		}
+	} else {
+		tasks, content, err := a.queryFiles(formattedSystemPrompt, prompt)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("OpenAI response: %s", content)
+
+		a.emitTasks(tasks)
+	}
+
+	a.repair(formattedSystemPrompt)
+
+	if a.withTests {
+		a.generateTests(formattedSystemPrompt)
+	}
+
+	return nil
+}
+
+// prepare resolves the selected template, queues its static files and
+// renders the system prompt for the agent's language.
+func (a *Agent) prepare() (string, error) {
 	tmpl, ok := a.templates[a.selectedTmpl]
 
 	if !ok {
-		return fmt.Errorf("template %s not found", a.selectedTmpl)
+		return "", fmt.Errorf("template %s not found", a.selectedTmpl)
 	}
 
 	if tmpl.Language != "" {
@@ -370,6 +553,18 @@ func (a *Agent) GenerateCode(prompt string) error {
 
 	log.Printf("Generating code for instruction using template: %s (language: %s)", a.selectedTmpl, a.language)
 
+	sampling := a.sampling.merge(tmpl.Sampling)
+	if err := sampling.Validate(a.openAI.provider, a.openAI.model); err != nil {
+		return "", fmt.Errorf("invalid sampling parameters: %w", err)
+	}
+	a.openAI.sampling = sampling
+
+	pipeline, err := a.buildPipeline(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("error building post-processor pipeline: %w", err)
+	}
+	a.pipeline = pipeline
+
 	for path, content := range tmpl.Files {
 		tmplContent, err := a.processTemplate(content)
 		if err != nil {
@@ -377,16 +572,16 @@ func (a *Agent) GenerateCode(prompt string) error {
 			tmplContent = content
 		}
 
-		if a.progressCallback != nil {
-			a.progressCallback("file", "Sending file to queue", path)
-		}
-
-		a.taskQueue <- FileTask{
+		a.emitFile(FileTask{
 			Path:    path,
 			Content: tmplContent,
-		}
+		})
+
+		log.Printf("Wrote template file: %s", path)
+	}
 
-		log.Printf("Added template file to queue: %s", path)
+	if err := a.writeLicense(tmpl); err != nil {
+		return "", err
 	}
 
 	promptTemplate, ok := a.promptTmpls[a.language]
@@ -406,28 +601,20 @@ func (a *Agent) GenerateCode(prompt string) error {
 	var buf bytes.Buffer
 	t, err := template.New("prompt").Parse(promptTemplate.Template)
 	if err != nil {
-		return fmt.Errorf("error parsing prompt template: %w", err)
+		return "", fmt.Errorf("error parsing prompt template: %w", err)
 	}
 
 	if err := t.Execute(&buf, promptData); err != nil {
-		return fmt.Errorf("error executing prompt template: %w", err)
-	}
-
-	formattedSystemPrompt := buf.String()
-
-	res, err := a.openAI.Query(formattedSystemPrompt, prompt)
-	if err != nil {
-		return fmt.Errorf("error querying OpenAI: %w", err)
+		return "", fmt.Errorf("error executing prompt template: %w", err)
 	}
 
-	log.Printf("OpenAI response: %s", res.Choices[0].Message.Content)
-
-	// do something with OpenAI response
-	if err = a.ParseCode(res.Choices[0].Message.Content); err != nil {
-		return fmt.Errorf("error parsing code: %w", err)
-	}
+	return buf.String(), nil
+}
 
-	return nil
+// Template returns the template the agent generates from.
+func (a *Agent) Template() (ProjectTemplate, bool) {
+	tmpl, ok := a.templates[a.selectedTmpl]
+	return tmpl, ok
 }
 
 func (a *Agent) ListTemplates() []ProjectTemplate {
@@ -0,0 +1,364 @@
+package agents
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/guard"
+)
+
+// Issue is a problem found in the generated output by a post-write analyzer.
+type Issue struct {
+	File    string `json:"file"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	Fixed   bool   `json:"fixed"`
+}
+
+// GenerationResult summarises a finished generation.
+type GenerationResult struct {
+	Files  []string `json:"files"`
+	Issues []Issue  `json:"issues,omitempty"`
+	Plan   *Plan    `json:"plan,omitempty"`
+	Tests  []string `json:"tests,omitempty"`
+
+	// Protocol is the response protocol the model answered with.
+	Protocol string `json:"protocol"`
+	// Sampling is the sampling parameters the requests were sent with.
+	Sampling SamplingParams `json:"sampling"`
+	// Usage is the number of model requests and tokens the generation took.
+	Usage Usage `json:"usage"`
+
+	// Findings are secrets and suspicious instructions found in the prompt
+	// and secrets and dangerous commands found in the generated files.
+	Findings []guard.Finding `json:"findings,omitempty"`
+}
+
+var requireLineRegex = regexp.MustCompile(`(?m)^\s*(?:require\s+)?([^\s()]+)\s+v\S+`)
+
+type goFileInfo struct {
+	path        string
+	pkg         string
+	pkgOffset   int
+	imports     []string
+	importSpans [][2]int
+}
+
+// analyzeGo parses every generated Go file and checks that go.mod declares
+// the base package, that each directory holds a single package and that
+// imports of the project itself resolve to generated directories. With fix
+// set, mismatches are rewritten in place. Without a base package only the
+// package names are checked.
+func (a *Agent) analyzeGo(fix bool) []Issue {
+	var issues []Issue
+
+	goMod, hasGoMod := a.files["go.mod"]
+	switch {
+	case !hasGoMod:
+		issue := Issue{File: "go.mod", Kind: "missing-go-mod", Message: "no go.mod was generated"}
+		if fix && a.basePackage != "" {
+			issue.Fixed = a.rewriteFile("go.mod", fmt.Sprintf("module %s\n\ngo 1.22\n", a.basePackage))
+		}
+		issues = append(issues, issue)
+	case a.basePackage != "" && detectModulePath(goMod) != a.basePackage:
+		issue := Issue{
+			File:    "go.mod",
+			Kind:    "module-path",
+			Message: fmt.Sprintf("module path %q does not match base package %q", detectModulePath(goMod), a.basePackage),
+		}
+		if fix {
+			issue.Fixed = a.rewriteFile("go.mod", moduleLineRegex.ReplaceAllLiteralString(goMod, "module "+a.basePackage))
+		}
+		issues = append(issues, issue)
+	}
+
+	required := make(map[string]bool)
+	for _, m := range requireLineRegex.FindAllStringSubmatch(goMod, -1) {
+		required[m[1]] = true
+	}
+
+	infos, syntaxIssues := a.parseGoFiles()
+	issues = append(issues, syntaxIssues...)
+
+	issues = append(issues, a.checkPackages(infos, fix)...)
+
+	if a.basePackage != "" {
+		// Package fixes shift offsets, so parse again before touching imports.
+		infos, _ = a.parseGoFiles()
+		issues = append(issues, a.checkImports(infos, required, fix)...)
+	}
+
+	for _, issue := range issues {
+		log.Printf("Analyzer: %s: [%s] %s (fixed: %v)", issue.File, issue.Kind, issue.Message, issue.Fixed)
+	}
+
+	return issues
+}
+
+func (a *Agent) parseGoFiles() ([]*goFileInfo, []Issue) {
+	var infos []*goFileInfo
+	var issues []Issue
+
+	for _, p := range sortedKeys(a.files) {
+		if !isGoFile(p) {
+			continue
+		}
+
+		info, err := parseGoFile(p, a.files[p])
+		if err != nil {
+			issues = append(issues, Issue{File: p, Kind: "syntax", Message: err.Error()})
+			continue
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, issues
+}
+
+func parseGoFile(p, content string) (*goFileInfo, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, p, content, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &goFileInfo{
+		path:      p,
+		pkg:       f.Name.Name,
+		pkgOffset: fset.Position(f.Name.Pos()).Offset,
+	}
+
+	for _, spec := range f.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		info.imports = append(info.imports, importPath)
+		info.importSpans = append(info.importSpans, [2]int{
+			fset.Position(spec.Path.Pos()).Offset,
+			fset.Position(spec.Path.End()).Offset,
+		})
+	}
+
+	return info, nil
+}
+
+// checkPackages reports directories whose files disagree on the package
+// name, fixing them towards the most common name.
+func (a *Agent) checkPackages(infos []*goFileInfo, fix bool) []Issue {
+	var issues []Issue
+
+	byDir := make(map[string][]*goFileInfo)
+	for _, info := range infos {
+		dir := path.Dir(filepath.ToSlash(info.path))
+		byDir[dir] = append(byDir[dir], info)
+	}
+
+	for _, dir := range sortedKeys(byDir) {
+		files := byDir[dir]
+
+		counts := make(map[string]int)
+		for _, info := range files {
+			counts[strings.TrimSuffix(info.pkg, "_test")]++
+		}
+		if len(counts) < 2 {
+			continue
+		}
+
+		want := ""
+		for _, name := range sortedKeys(counts) {
+			if want == "" || counts[name] > counts[want] {
+				want = name
+			}
+		}
+
+		for _, info := range files {
+			name := strings.TrimSuffix(info.pkg, "_test")
+			if name == want {
+				continue
+			}
+
+			issue := Issue{
+				File:    info.path,
+				Kind:    "package-mismatch",
+				Message: fmt.Sprintf("package %s does not match package %s used by the rest of %s", info.pkg, want, dir),
+			}
+			if fix {
+				content := a.files[info.path]
+				content = content[:info.pkgOffset] + want + content[info.pkgOffset+len(name):]
+				issue.Fixed = a.rewriteFile(info.path, content)
+			}
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues
+}
+
+// checkImports verifies that imports of the base package point at generated
+// directories, and rebases imports of the module path the model declared
+// onto the base package. Other imports ending in a generated directory are
+// only reported, as they may well be third-party packages.
+func (a *Agent) checkImports(infos []*goFileInfo, required map[string]bool, fix bool) []Issue {
+	var issues []Issue
+
+	a.fileWriterMutex.Lock()
+	modulePath := a.modulePath
+	a.fileWriterMutex.Unlock()
+	if modulePath == a.basePackage {
+		modulePath = ""
+	}
+
+	dirs := make(map[string]bool)
+	for _, info := range infos {
+		dirs[path.Dir(filepath.ToSlash(info.path))] = true
+	}
+
+	for _, info := range infos {
+		content := a.files[info.path]
+		changed := false
+
+		// Walk backwards so replacements don't shift earlier offsets.
+		for i := len(info.imports) - 1; i >= 0; i-- {
+			importPath := info.imports[i]
+
+			var issue Issue
+			var target string
+
+			if rel, ok := cutModulePrefix(importPath, a.basePackage); ok {
+				if dirs[rel] {
+					continue
+				}
+				issue = Issue{
+					File:    info.path,
+					Kind:    "unresolved-import",
+					Message: fmt.Sprintf("import %q does not resolve to a generated directory", importPath),
+				}
+				if dir, ok := matchGeneratedDir(rel, dirs); ok {
+					target = joinImport(a.basePackage, dir)
+				}
+			} else if rel, ok := cutModulePrefix(importPath, modulePath); ok {
+				issue = Issue{
+					File:    info.path,
+					Kind:    "foreign-module-import",
+					Message: fmt.Sprintf("import %q uses module path %q instead of base package %q", importPath, modulePath, a.basePackage),
+				}
+				if dirs[rel] {
+					target = joinImport(a.basePackage, rel)
+				} else if dir, ok := matchGeneratedDir(rel, dirs); ok {
+					target = joinImport(a.basePackage, dir)
+				}
+			} else {
+				_, ok := matchGeneratedDir(importPath, dirs)
+				if !ok || isRequired(importPath, required) || !strings.Contains(strings.Split(importPath, "/")[0], ".") {
+					continue
+				}
+				issue = Issue{
+					File:    info.path,
+					Kind:    "foreign-module-import",
+					Message: fmt.Sprintf("import %q looks like a generated package outside base package %q", importPath, a.basePackage),
+				}
+			}
+
+			if fix && target != "" {
+				span := info.importSpans[i]
+				content = content[:span[0]] + strconv.Quote(target) + content[span[1]:]
+				issue.Message += fmt.Sprintf(", rewritten to %q", target)
+				issue.Fixed = true
+				changed = true
+			}
+			issues = append(issues, issue)
+		}
+
+		if changed && !a.rewriteFile(info.path, content) {
+			for i := range issues {
+				if issues[i].File == info.path {
+					issues[i].Fixed = false
+				}
+			}
+		}
+	}
+
+	return issues
+}
+
+func cutModulePrefix(importPath, module string) (string, bool) {
+	if module == "" {
+		return "", false
+	}
+	if importPath == module {
+		return ".", true
+	}
+	return strings.CutPrefix(importPath, module+"/")
+}
+
+func joinImport(module, dir string) string {
+	if dir == "." {
+		return module
+	}
+	return module + "/" + dir
+}
+
+func isRequired(importPath string, required map[string]bool) bool {
+	for module := range required {
+		if _, ok := cutModulePrefix(importPath, module); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGeneratedDir finds the generated directory sharing the longest path
+// suffix with importPath.
+func matchGeneratedDir(importPath string, dirs map[string]bool) (string, bool) {
+	segments := strings.Split(importPath, "/")
+	for i := range segments {
+		candidate := strings.Join(segments[i:], "/")
+		if dirs[candidate] {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// rewriteFile replaces the content of an already generated file.
+func (a *Agent) rewriteFile(p, content string) bool {
+	a.fileWriterMutex.Lock()
+	a.files[p] = content
+	a.fileWriterMutex.Unlock()
+
+	if a.dryRun {
+		return true
+	}
+
+	fullPath := filepath.Join(a.outputDir, p)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		log.Printf("Error creating directories for %s: %v", fullPath, err)
+		return false
+	}
+
+	if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+		log.Printf("Error rewriting file %s: %v", fullPath, err)
+		return false
+	}
+
+	return true
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
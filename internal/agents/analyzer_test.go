@@ -0,0 +1,233 @@
+package agents
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeGo(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	const base = "example.com/shop"
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		// modulePath is the module path the model declared.
+		modulePath string
+		// noBasePackage runs the analyzer without a base package.
+		noBasePackage bool
+		wantKinds     []string
+		// want holds the content expected after fixing, for the files it names.
+		want map[string]string
+	}{
+		{
+			name: "clean project",
+			files: map[string]string{
+				"go.mod":         "module example.com/shop\n\ngo 1.22\n",
+				"main.go":        "package main\n\nimport \"example.com/shop/store\"\n\nfunc main() { store.Open() }\n",
+				"store/store.go": "package store\n\nfunc Open() {}\n",
+			},
+		},
+		{
+			name: "missing go.mod",
+			files: map[string]string{
+				"main.go": "package main\n",
+			},
+			wantKinds: []string{"missing-go-mod"},
+			want: map[string]string{
+				"go.mod": "module example.com/shop\n\ngo 1.22\n",
+			},
+		},
+		{
+			name: "wrong module path",
+			files: map[string]string{
+				"go.mod":  "module shop\n\ngo 1.22\n",
+				"main.go": "package main\n",
+			},
+			wantKinds: []string{"module-path"},
+			want: map[string]string{
+				"go.mod": "module example.com/shop\n\ngo 1.22\n",
+			},
+		},
+		{
+			name: "package mismatch is fixed towards the majority",
+			files: map[string]string{
+				"go.mod":                "module example.com/shop\n",
+				"store/store.go":        "package store\n",
+				"store/sql.go":          "package store\n",
+				"store/cache.go":        "package cache\n\nfunc Get() {}\n",
+				"store/store_test.go":   "package store_test\n",
+				"store/internal_doc.go": "// Package store keeps orders.\npackage store\n",
+			},
+			wantKinds: []string{"package-mismatch"},
+			want: map[string]string{
+				"store/cache.go":      "package store\n\nfunc Get() {}\n",
+				"store/store_test.go": "package store_test\n",
+			},
+		},
+		{
+			name: "import of a missing directory is rebased onto a generated one",
+			files: map[string]string{
+				"go.mod":        "module example.com/shop\n",
+				"main.go":       "package main\n\nimport \"example.com/shop/internal/handlers\"\n",
+				"handlers/h.go": "package handlers\n",
+			},
+			wantKinds: []string{"unresolved-import"},
+			want: map[string]string{
+				"main.go": "package main\n\nimport \"example.com/shop/handlers\"\n",
+			},
+		},
+		{
+			name: "unresolvable import is reported but left alone",
+			files: map[string]string{
+				"go.mod":  "module example.com/shop\n",
+				"main.go": "package main\n\nimport \"example.com/shop/missing\"\n",
+			},
+			wantKinds: []string{"unresolved-import"},
+			want: map[string]string{
+				"main.go": "package main\n\nimport \"example.com/shop/missing\"\n",
+			},
+		},
+		{
+			name: "invented module path is rebased",
+			files: map[string]string{
+				"go.mod": "module example.com/shop\n",
+				"main.go": "package main\n\nimport (\n\t\"fmt\"\n\t\"github.com/acme/shop/store\"\n" +
+					"\t\"github.com/acme/shop/api\"\n)\n",
+				"store/store.go": "package store\n",
+				"api/api.go":     "package api\n",
+			},
+			modulePath: "github.com/acme/shop",
+			wantKinds:  []string{"foreign-module-import", "foreign-module-import"},
+			want: map[string]string{
+				"main.go": "package main\n\nimport (\n\t\"fmt\"\n\t\"example.com/shop/store\"\n" +
+					"\t\"example.com/shop/api\"\n)\n",
+			},
+		},
+		{
+			name: "required modules and the standard library are not rebased",
+			files: map[string]string{
+				"go.mod": "module example.com/shop\n\nrequire github.com/acme/store v1.2.0\n",
+				"main.go": "package main\n\nimport (\n\t\"github.com/acme/store\"\n\t\"net/http\"\n" +
+					"\t\"encoding/json\"\n)\n",
+				"store/store.go": "package store\n",
+				"json/json.go":   "package json\n",
+			},
+		},
+		{
+			name: "third-party imports ending in a generated directory are only reported",
+			files: map[string]string{
+				"main.go":            "package main\n\nimport \"github.com/go-chi/chi/v5/middleware\"\n",
+				"middleware/auth.go": "package middleware\n",
+			},
+			modulePath: "github.com/acme/shop",
+			wantKinds:  []string{"missing-go-mod", "foreign-module-import"},
+			want: map[string]string{
+				"go.mod":  "module example.com/shop\n\ngo 1.22\n",
+				"main.go": "package main\n\nimport \"github.com/go-chi/chi/v5/middleware\"\n",
+			},
+		},
+		{
+			name: "without a base package only packages are checked",
+			files: map[string]string{
+				"go.mod":         "module github.com/acme/shop\n",
+				"main.go":        "package main\n\nimport \"github.com/acme/shop/store\"\n",
+				"store/store.go": "package store\n",
+				"store/sql.go":   "package store\n",
+				"store/db.go":    "package db\n",
+			},
+			modulePath:    "github.com/acme/shop",
+			noBasePackage: true,
+			wantKinds:     []string{"package-mismatch"},
+			want: map[string]string{
+				"go.mod":      "module github.com/acme/shop\n",
+				"main.go":     "package main\n\nimport \"github.com/acme/shop/store\"\n",
+				"store/db.go": "package store\n",
+			},
+		},
+		{
+			name: "missing go.mod without a base package is not written",
+			files: map[string]string{
+				"main.go": "package main\n",
+			},
+			noBasePackage: true,
+			wantKinds:     []string{"missing-go-mod"},
+			want: map[string]string{
+				"go.mod": "",
+			},
+		},
+		{
+			name: "syntax errors are reported",
+			files: map[string]string{
+				"go.mod":  "module example.com/shop\n",
+				"main.go": "package main\n\nimport (\n",
+			},
+			wantKinds: []string{"syntax"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, fix := range []bool{false, true} {
+				files := make(map[string]string, len(tt.files))
+				for p, content := range tt.files {
+					files[p] = content
+				}
+				a := &Agent{basePackage: base, modulePath: tt.modulePath, files: files, dryRun: true}
+				if tt.noBasePackage {
+					a.basePackage = ""
+				}
+
+				issues := a.analyzeGo(fix)
+
+				var kinds []string
+				for _, issue := range issues {
+					kinds = append(kinds, issue.Kind)
+					want, ok := tt.want[issue.File]
+					if issue.Fixed != (fix && ok && want != tt.files[issue.File]) {
+						t.Errorf("fix=%v: %s [%s] fixed = %v", fix, issue.File, issue.Kind, issue.Fixed)
+					}
+				}
+				if !reflect.DeepEqual(kinds, tt.wantKinds) {
+					t.Errorf("fix=%v: issue kinds = %v, want %v", fix, kinds, tt.wantKinds)
+				}
+
+				for p, want := range tt.want {
+					if !fix {
+						want = tt.files[p]
+					}
+					if got := a.files[p]; got != want {
+						t.Errorf("fix=%v: %s = %q, want %q", fix, p, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMatchGeneratedDir(t *testing.T) {
+	dirs := map[string]bool{".": true, "store": true, "internal/store": true, "api": true}
+
+	tests := []struct {
+		importPath string
+		want       string
+		ok         bool
+	}{
+		{"github.com/acme/shop/internal/store", "internal/store", true},
+		{"github.com/acme/shop/store", "store", true},
+		{"api", "api", true},
+		{"github.com/acme/shop/web", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := matchGeneratedDir(tt.importPath, dirs)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("matchGeneratedDir(%q) = %q, %v, want %q, %v", tt.importPath, got, ok, tt.want, tt.ok)
+		}
+	}
+}
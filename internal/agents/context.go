@@ -0,0 +1,303 @@
+package agents
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultContextTokens is the token budget used when none is given.
+	DefaultContextTokens = 8000
+
+	maxContextFileSize = 256 * 1024
+
+	// maxContextBytes and maxContextEntries bound the work of loading a
+	// context: the bytes read across all files and the entries visited.
+	// Compressed sizes say nothing about either.
+	maxContextBytes   = 16 << 20
+	maxContextEntries = 10000
+)
+
+var (
+	contextSkipDirs = map[string]bool{
+		".git":         true,
+		"node_modules": true,
+		"vendor":       true,
+		"__pycache__":  true,
+		".venv":        true,
+		"venv":         true,
+		"dist":         true,
+		"build":        true,
+		"target":       true,
+	}
+
+	// manifestFiles describe the project as a whole and are always picked first.
+	manifestFiles = map[string]bool{
+		"go.mod":           true,
+		"package.json":     true,
+		"requirements.txt": true,
+		"pyproject.toml":   true,
+		"setup.py":         true,
+		"pom.xml":          true,
+		"build.gradle":     true,
+		"Makefile":         true,
+		"README.md":        true,
+	}
+
+	stopWords = map[string]bool{
+		"the": true, "and": true, "for": true, "with": true, "that": true,
+		"this": true, "add": true, "create": true, "make": true, "use": true,
+		"from": true, "into": true, "should": true, "app": true, "code": true,
+	}
+)
+
+// ContextFile is an existing project file included in the prompt.
+type ContextFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// ProjectContext is a selection of existing project files sent along with
+// the prompt so generated code follows the project's conventions.
+type ProjectContext struct {
+	Files   []ContextFile `json:"files"`
+	Tokens  int           `json:"tokens"`
+	Skipped int           `json:"skipped"`
+	// Truncated is set when the project was too large to be read entirely.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+type contextCandidate struct {
+	file   ContextFile
+	score  int
+	tokens int
+}
+
+// LoadContextDir selects files from an existing project directory.
+func LoadContextDir(root, prompt string, tokenBudget int) (*ProjectContext, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("reading context directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("context path %s is not a directory", root)
+	}
+
+	return LoadContext(os.DirFS(root), prompt, tokenBudget)
+}
+
+// LoadContextZip selects files from a zip archive of an existing project.
+func LoadContextZip(data []byte, prompt string, tokenBudget int) (*ProjectContext, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("reading context zip: %w", err)
+	}
+
+	return LoadContext(reader, prompt, tokenBudget)
+}
+
+// LoadContext walks fsys, skipping anything excluded by .gitignore files,
+// binaries and dependency directories, and keeps the files most relevant to
+// prompt that fit within tokenBudget. The walk stops early once it has
+// visited maxContextEntries entries or read maxContextBytes.
+func LoadContext(fsys fs.FS, prompt string, tokenBudget int) (*ProjectContext, error) {
+	if tokenBudget <= 0 {
+		tokenBudget = DefaultContextTokens
+	}
+
+	keywords := promptKeywords(prompt)
+	ignore := &ignoreMatcher{}
+	var candidates []contextCandidate
+
+	var (
+		entries   int
+		read      int64
+		truncated bool
+	)
+
+	// readFile reads a file of at most maxContextFileSize bytes within
+	// what is left of maxContextBytes. stop reports that the budget ran
+	// out before the file did.
+	readFile := func(p string) (data []byte, stop bool, err error) {
+		limit := min(maxContextFileSize, maxContextBytes-read)
+		data, ok, err := readLimited(fsys, p, limit)
+		read += int64(len(data))
+		if err != nil || ok {
+			return data, false, err
+		}
+		if limit < maxContextFileSize {
+			return nil, true, nil
+		}
+		return nil, false, errFileTooLarge
+	}
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		entries++
+		if entries > maxContextEntries || read >= maxContextBytes {
+			truncated = true
+			return fs.SkipAll
+		}
+
+		if d.IsDir() {
+			if p != "." && (contextSkipDirs[d.Name()] || ignore.ignored(p, true)) {
+				return fs.SkipDir
+			}
+
+			data, stop, err := readFile(path.Join(p, ".gitignore"))
+			if stop {
+				truncated = true
+				return fs.SkipAll
+			}
+			if err == nil {
+				ignore.add(p, string(data))
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() || ignore.ignored(p, false) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || info.Size() > maxContextFileSize {
+			return nil
+		}
+
+		data, stop, err := readFile(p)
+		if stop {
+			truncated = true
+			return fs.SkipAll
+		}
+		if err != nil || isBinary(data) {
+			return nil
+		}
+
+		file := ContextFile{Path: p, Content: string(data)}
+		candidates = append(candidates, contextCandidate{
+			file:   file,
+			score:  scoreContextFile(file, keywords),
+			tokens: estimateTokens(file.Path) + estimateTokens(file.Content),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking context files: %w", err)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].tokens < candidates[j].tokens
+	})
+
+	pc := &ProjectContext{Truncated: truncated}
+	for _, c := range candidates {
+		if pc.Tokens+c.tokens > tokenBudget {
+			pc.Skipped++
+			continue
+		}
+		pc.Files = append(pc.Files, c.file)
+		pc.Tokens += c.tokens
+	}
+
+	sort.Slice(pc.Files, func(i, j int) bool {
+		return pc.Files[i].Path < pc.Files[j].Path
+	})
+
+	return pc, nil
+}
+
+var errFileTooLarge = errors.New("file too large")
+
+// readLimited reads the file at p if it is at most limit bytes long. ok is
+// false, and data holds the first limit+1 bytes, when it is longer.
+func readLimited(fsys fs.FS, p string, limit int64) (data []byte, ok bool, err error) {
+	f, err := fsys.Open(p)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	data, err = io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return data, false, err
+	}
+	return data, int64(len(data)) <= limit, nil
+}
+
+// Prompt renders the selected files as a block to append to the user prompt.
+func (pc *ProjectContext) Prompt() string {
+	if pc == nil || len(pc.Files) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n\nThe following files are from the existing project. Extend it, follow its conventions and package layout, and only output files you create or change.\n")
+	for _, f := range pc.Files {
+		fmt.Fprintf(&b, "\n<file path=%q>\n%s\n</file>\n", f.Path, strings.TrimRight(f.Content, "\n"))
+	}
+
+	return b.String()
+}
+
+// estimateTokens approximates the token count at four bytes per token.
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
+
+func promptKeywords(prompt string) []string {
+	words := strings.FieldsFunc(strings.ToLower(prompt), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool)
+	var keywords []string
+	for _, w := range words {
+		if len(w) < 3 || stopWords[w] || seen[w] {
+			continue
+		}
+		seen[w] = true
+		keywords = append(keywords, w)
+	}
+
+	return keywords
+}
+
+// scoreContextFile ranks a file by how often the prompt's keywords appear in
+// its path and content.
+func scoreContextFile(f ContextFile, keywords []string) int {
+	score := 0
+	if manifestFiles[path.Base(f.Path)] {
+		score += 100
+	}
+
+	lowerPath := strings.ToLower(f.Path)
+	lowerContent := strings.ToLower(f.Content)
+	for _, k := range keywords {
+		if strings.Contains(lowerPath, k) {
+			score += 10
+		}
+		score += min(strings.Count(lowerContent, k), 10)
+	}
+
+	return score
+}
@@ -0,0 +1,69 @@
+package agents
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// contextZip zips n files of size bytes each.
+func contextZip(t *testing.T, n, size int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	content := strings.Repeat("a", size)
+	for i := range n {
+		w, err := zw.Create(fmt.Sprintf("src/file%05d.txt", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoadContextZipLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     int
+		size      int
+		truncated bool
+		// maxFiles bounds the files the walk may have read, for a
+		// budget large enough to keep all of them.
+		maxFiles int
+	}{
+		{name: "small project", files: 10, size: 100, maxFiles: 10},
+		{name: "too many entries", files: maxContextEntries + 10, size: 1, truncated: true, maxFiles: maxContextEntries},
+		{name: "too many bytes", files: 2 * maxContextBytes / maxContextFileSize, size: maxContextFileSize, truncated: true, maxFiles: maxContextBytes / maxContextFileSize},
+		{name: "oversized files", files: 5, size: maxContextFileSize + 1, maxFiles: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := contextZip(t, tt.files, tt.size)
+
+			pc, err := LoadContextZip(data, "", 1<<30)
+			if err != nil {
+				t.Fatalf("LoadContextZip: %v", err)
+			}
+
+			if pc.Truncated != tt.truncated {
+				t.Errorf("Truncated = %v, want %v", pc.Truncated, tt.truncated)
+			}
+			if got := len(pc.Files) + pc.Skipped; got > tt.maxFiles {
+				t.Errorf("read %d files, want at most %d", got, tt.maxFiles)
+			}
+			if !tt.truncated && len(pc.Files) != min(tt.files, tt.maxFiles) {
+				t.Errorf("kept %d files, want %d", len(pc.Files), min(tt.files, tt.maxFiles))
+			}
+		})
+	}
+}
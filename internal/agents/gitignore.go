@@ -0,0 +1,120 @@
+package agents
+
+import (
+	"path"
+	"strings"
+)
+
+type ignoreRule struct {
+	base     string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreMatcher applies .gitignore rules collected while walking a tree.
+// Later rules win, matching git's behaviour.
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// add parses the contents of the .gitignore found in dir.
+func (m *ignoreMatcher) add(dir, contents string) {
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimRight(line, " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: dir}
+
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+
+		// A slash anywhere but the end anchors the pattern to its directory.
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+
+		if line == "" {
+			continue
+		}
+
+		rule.pattern = line
+		m.rules = append(m.rules, rule)
+	}
+}
+
+// ignored reports whether the slash-separated path p is excluded.
+func (m *ignoreMatcher) ignored(p string, isDir bool) bool {
+	ignored := false
+
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		rel := p
+		if rule.base != "." {
+			var ok bool
+			rel, ok = strings.CutPrefix(p, rule.base+"/")
+			if !ok {
+				continue
+			}
+		}
+
+		var matched bool
+		if rule.anchored {
+			matched = matchGlob(rule.pattern, rel)
+		} else {
+			matched = matchGlob(rule.pattern, path.Base(rel))
+		}
+
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
+
+// matchGlob matches a slash-separated path against a pattern where "**"
+// spans any number of path segments.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
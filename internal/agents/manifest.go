@@ -0,0 +1,206 @@
+package agents
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed licenses/*.txt
+var licenseFS embed.FS
+
+// ManifestPath is where the provenance manifest is written in generated
+// projects.
+const ManifestPath = ".codegen/manifest.json"
+
+// LicenseNone disables the license a template adds by default.
+const LicenseNone = "none"
+
+// ManifestFile records the checksum of a generated file.
+type ManifestFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+}
+
+// Manifest describes how a project was generated.
+type Manifest struct {
+	GeneratorVersion string         `json:"generatorVersion"`
+	Template         string         `json:"template"`
+	TemplateVersion  string         `json:"templateVersion,omitempty"`
+	Language         string         `json:"language"`
+	Provider         string         `json:"provider"`
+	Model            string         `json:"model"`
+	Protocol         string         `json:"protocol"`
+	Sampling         SamplingParams `json:"sampling"`
+	PromptSHA256     string         `json:"promptSha256"`
+	License          string         `json:"license,omitempty"`
+	CreatedAt        time.Time      `json:"createdAt"`
+	Files            []ManifestFile `json:"files"`
+}
+
+// Licenses returns the SPDX identifiers of the licenses that can be added to
+// generated projects.
+func Licenses() []string {
+	entries, err := licenseFS.ReadDir("licenses")
+	if err != nil {
+		return nil
+	}
+
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, strings.TrimSuffix(e.Name(), ".txt"))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// lookupLicense returns the canonical identifier of a license, matching
+// case-insensitively.
+func lookupLicense(id string) (string, bool) {
+	for _, known := range Licenses() {
+		if strings.EqualFold(known, id) {
+			return known, true
+		}
+	}
+	return "", false
+}
+
+// SetLicense picks the license added to the generated project, overriding
+// the template's default. "none" adds no license. The holder is named in the
+// copyright line.
+func (a *Agent) SetLicense(id, holder string) error {
+	if id != "" && !strings.EqualFold(id, LicenseNone) {
+		known, ok := lookupLicense(id)
+		if !ok {
+			return fmt.Errorf("unknown license %q (expected one of %s or none)", id, strings.Join(Licenses(), ", "))
+		}
+		id = known
+	}
+
+	a.license = id
+	a.licenseHolder = holder
+	return nil
+}
+
+// License returns the license of the generated project, if any.
+func (a *Agent) License() string {
+	id := a.license
+	if id == "" {
+		id = a.templates[a.selectedTmpl].License
+	}
+	if strings.EqualFold(id, LicenseNone) {
+		return ""
+	}
+	if known, ok := lookupLicense(id); ok {
+		return known
+	}
+	return id
+}
+
+// writeLicense adds a LICENSE file to the project when the request or the
+// template selects one.
+func (a *Agent) writeLicense(tmpl ProjectTemplate) error {
+	id := a.License()
+	if id == "" {
+		return nil
+	}
+
+	text, err := licenseFS.ReadFile("licenses/" + id + ".txt")
+	if err != nil {
+		return fmt.Errorf("template %s: unknown license %q", tmpl.Name, id)
+	}
+
+	holder := a.licenseHolder
+	if holder == "" {
+		holder = "The " + path.Base(a.basePackage) + " authors"
+	}
+
+	t, err := template.New("license").Parse(string(text))
+	if err != nil {
+		return fmt.Errorf("error parsing license %s: %w", id, err)
+	}
+
+	var buf bytes.Buffer
+	data := struct {
+		Year   int
+		Holder string
+	}{time.Now().Year(), holder}
+	if err := t.Execute(&buf, data); err != nil {
+		return fmt.Errorf("error rendering license %s: %w", id, err)
+	}
+
+	a.emitFile(FileTask{Path: "LICENSE", Content: buf.String()})
+	return nil
+}
+
+// Manifest describes the generated project and lists a checksum for every
+// file written so far.
+func (a *Agent) Manifest(generatorVersion string) Manifest {
+	files := a.Files()
+	delete(files, ManifestPath)
+
+	m := Manifest{
+		GeneratorVersion: generatorVersion,
+		Template:         a.selectedTmpl,
+		TemplateVersion:  a.templates[a.selectedTmpl].Version,
+		Language:         a.language,
+		Provider:         a.openAI.provider,
+		Model:            a.openAI.model,
+		Protocol:         a.Protocol(),
+		Sampling:         a.Sampling(),
+		PromptSHA256:     a.promptHash,
+		License:          a.License(),
+		CreatedAt:        time.Now().UTC(),
+		Files:            make([]ManifestFile, 0, len(files)),
+	}
+
+	for _, p := range sortedKeys(files) {
+		m.Files = append(m.Files, ManifestFile{
+			Path:   p,
+			SHA256: hashContent(files[p]),
+			Size:   len(files[p]),
+		})
+	}
+
+	return m
+}
+
+// WriteManifest writes the provenance manifest into the project. Call it
+// after Finish so the checksums cover the final files.
+func (a *Agent) WriteManifest(generatorVersion string) (Manifest, error) {
+	m := a.Manifest(generatorVersion)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, fmt.Errorf("error encoding manifest: %w", err)
+	}
+
+	if !a.rewriteFile(ManifestPath, string(data)+"\n") {
+		return m, fmt.Errorf("error writing %s", ManifestPath)
+	}
+
+	return m, nil
+}
+
+// Paths returns the paths of the project's files, including the manifest.
+func (m Manifest) Paths() []string {
+	paths := make([]string, 0, len(m.Files)+1)
+	for _, f := range m.Files {
+		paths = append(paths, f.Path)
+	}
+	return append(paths, ManifestPath)
+}
+
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,120 @@
+package agents
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+//go:embed models.json
+var defaultModelCatalogue []byte
+
+// ModelPricing is the price of a model in USD per million tokens.
+type ModelPricing struct {
+	InputPerMillion  float64 `json:"inputPerMillion"`
+	OutputPerMillion float64 `json:"outputPerMillion"`
+}
+
+// ModelInfo describes a model the server allows and what it supports.
+type ModelInfo struct {
+	Name            string       `json:"name"`
+	Provider        string       `json:"provider"`
+	ContextWindow   int          `json:"contextWindow"`
+	MaxOutputTokens int          `json:"maxOutputTokens"`
+	Pricing         ModelPricing `json:"pricing"`
+	JSONMode        bool         `json:"jsonMode"`
+	Streaming       bool         `json:"streaming"`
+	Reasoning       bool         `json:"reasoning,omitempty"`
+}
+
+type modelCatalogue struct {
+	Models []ModelInfo `json:"models"`
+}
+
+var (
+	modelsMu sync.RWMutex
+	models   map[string]ModelInfo
+)
+
+func init() {
+	m, err := parseModelCatalogue(defaultModelCatalogue)
+	if err != nil {
+		panic(err)
+	}
+	models = m
+}
+
+func parseModelCatalogue(data []byte) (map[string]ModelInfo, error) {
+	var c modelCatalogue
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing model catalogue: %w", err)
+	}
+
+	m := make(map[string]ModelInfo, len(c.Models))
+	for _, info := range c.Models {
+		if info.Name == "" {
+			return nil, fmt.Errorf("model catalogue: model without a name")
+		}
+		if _, ok := samplingValidators[info.Provider]; !ok {
+			return nil, fmt.Errorf("model catalogue: %s: unknown provider %q", info.Name, info.Provider)
+		}
+		if _, dup := m[info.Name]; dup {
+			return nil, fmt.Errorf("model catalogue: %s listed twice", info.Name)
+		}
+		m[info.Name] = info
+	}
+
+	return m, nil
+}
+
+// LoadModelCatalogue replaces the built-in model catalogue with the models
+// listed in a JSON config file.
+func LoadModelCatalogue(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	m, err := parseModelCatalogue(data)
+	if err != nil {
+		return err
+	}
+
+	modelsMu.Lock()
+	models = m
+	modelsMu.Unlock()
+
+	return nil
+}
+
+// ListModels returns the catalogue sorted by provider and name.
+func ListModels() []ModelInfo {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+
+	list := make([]ModelInfo, 0, len(models))
+	for _, info := range models {
+		list = append(list, info)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Provider != list[j].Provider {
+			return list[i].Provider < list[j].Provider
+		}
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+// LookupModel returns the catalogue entry for a model.
+func LookupModel(name string) (ModelInfo, bool) {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+
+	info, ok := models[name]
+	return info, ok
+}
@@ -7,30 +7,62 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"sync"
 	"time"
 )
 
 const (
 	OpenAPIEndpoint = "https://api.openai.com/v1/chat/completions"
+
+	// ProviderOpenAI identifies OpenAI for per-provider concurrency limits.
+	ProviderOpenAI = "openai"
 )
 
 type OpenAPIResponse struct {
 	Choices []struct {
 		Message struct {
-			Content string `json:"content"`
+			Content   string     `json:"content"`
+			ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 		} `json:"message"`
 	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
 	Error *struct {
 		Message string `json:"message"`
+		Param   string `json:"param,omitempty"`
 	} `json:"error,omitempty"`
 }
 
+// Usage counts the requests sent to the model and the tokens they used.
+type Usage struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+type ToolCall struct {
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
 type OpenAPI struct {
 	httpClient *http.Client
 	ctx        context.Context
 	apiKey     string
 	model      string
+	provider   string
+	sampling   SamplingParams
+
+	usageMutex sync.Mutex
+	usage      Usage
 }
 
 func NewOpenAI(ctx context.Context, apiKey, model string, httpClient *http.Client) *OpenAPI {
@@ -39,6 +71,7 @@ func NewOpenAI(ctx context.Context, apiKey, model string, httpClient *http.Clien
 		apiKey:     apiKey,
 		model:      model,
 		httpClient: httpClient,
+		provider:   ProviderOpenAI,
 	}
 
 	if httpClient == nil {
@@ -51,13 +84,19 @@ func NewOpenAI(ctx context.Context, apiKey, model string, httpClient *http.Clien
 }
 
 func (o *OpenAPI) Query(systemPrompt, prompt string) (OpenAPIResponse, error) {
+	return o.query(systemPrompt, prompt, nil)
+}
+
+// query sends a chat completion request, merging extra into the request
+// body.
+func (o *OpenAPI) query(systemPrompt, prompt string, extra map[string]interface{}) (OpenAPIResponse, error) {
 	var response OpenAPIResponse
 
 	if systemPrompt == "" {
 		systemPrompt = "You are a helpful assistant."
 	}
 
-	bs, err := json.Marshal(map[string]interface{}{
+	request := map[string]interface{}{
 		"model": o.model,
 		"messages": []map[string]string{
 			{
@@ -69,34 +108,26 @@ func (o *OpenAPI) Query(systemPrompt, prompt string) (OpenAPIResponse, error) {
 				"content": prompt,
 			},
 		},
-	})
-
-	if err != nil {
-		return response, err
 	}
-
-	req, err := http.NewRequestWithContext(o.ctx, "POST", OpenAPIEndpoint, bytes.NewBuffer(bs))
-	if err != nil {
-		return response, fmt.Errorf("error creating request: %w", err)
+	o.sampling.apply(request, o.model)
+	for k, v := range extra {
+		request[k] = v
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+o.apiKey)
-
-	resp, err := o.httpClient.Do(req)
+	bs, err := json.Marshal(request)
 	if err != nil {
-		return response, fmt.Errorf("error sending request: %w", err)
+		return response, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := o.send(bs)
 	if err != nil {
-		return response, fmt.Errorf("error reading response: %w", err)
+		return response, err
 	}
 
 	if err := json.Unmarshal(body, &response); err != nil {
 		return response, fmt.Errorf("error unmarshaling response: %w", err)
 	}
+	o.addUsage(response)
 
 	if response.Error != nil {
 		return response, fmt.Errorf("API error: %s", response.Error.Message)
@@ -108,3 +139,64 @@ func (o *OpenAPI) Query(systemPrompt, prompt string) (OpenAPIResponse, error) {
 
 	return response, nil
 }
+
+func (o *OpenAPI) addUsage(response OpenAPIResponse) {
+	o.usageMutex.Lock()
+	defer o.usageMutex.Unlock()
+
+	o.usage.Requests++
+	o.usage.PromptTokens += response.Usage.PromptTokens
+	o.usage.CompletionTokens += response.Usage.CompletionTokens
+	o.usage.TotalTokens += response.Usage.TotalTokens
+}
+
+// Usage returns the requests and tokens used so far.
+func (o *OpenAPI) Usage() Usage {
+	o.usageMutex.Lock()
+	defer o.usageMutex.Unlock()
+	return o.usage
+}
+
+// send posts a request body to the provider, holding one of its concurrency
+// slots and retrying with shared back-off when the provider rate limits us.
+func (o *OpenAPI) send(bs []byte) ([]byte, error) {
+	limiter := limiterFor(o.provider)
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(o.ctx, "POST", OpenAPIEndpoint, bytes.NewBuffer(bs))
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+
+		if err := limiter.acquire(o.ctx); err != nil {
+			return nil, err
+		}
+
+		resp, err := o.httpClient.Do(req)
+		if err != nil {
+			limiter.release()
+			return nil, fmt.Errorf("error sending request: %w", err)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		limiter.observe(resp.Header)
+		limiter.release()
+
+		if err != nil {
+			return nil, fmt.Errorf("error reading response: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRateLimitRetries {
+			delay := retryDelay(resp.Header, attempt)
+			log.Printf("Rate limited by %s, retrying in %s", o.provider, delay)
+			limiter.pause(delay)
+			continue
+		}
+
+		return body, nil
+	}
+}
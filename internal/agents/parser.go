@@ -2,37 +2,74 @@ package agents
 
 import (
 	"log"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
 
+var (
+	codeBlockRegex  = regexp.MustCompile(`(?s)---FILE_PATH: (.+?)\n(.*?)---END_FILE`)
+	openFenceRegex  = regexp.MustCompile("^```[a-zA-Z0-9]*\n")
+	closeFenceRegex = regexp.MustCompile("\n```$")
+)
+
 func (a *Agent) ParseCode(content string) error {
+	a.emitTasks(extractFiles(content))
+	return nil
+}
 
-	codeBlockRegex := regexp.MustCompile(`(?s)---FILE_PATH: (.+?)\n(.*?)---END_FILE`)
-	matches := codeBlockRegex.FindAllStringSubmatch(content, -1)
+// emitTasks writes the files of a model response.
+func (a *Agent) emitTasks(tasks []FileTask) {
+	if len(tasks) == 0 {
+		log.Printf("Could not find any files in the response")
+		return
+	}
 
-	if len(matches) == 0 {
-		log.Printf("Could not find FILE_PATH in codeblock content")
-		return nil
+	a.detectModulePath(tasks)
+
+	for _, task := range tasks {
+		a.emitFile(task)
 	}
-	for _, match := range matches {
+}
 
-		if len(match) < 3 {
-			log.Printf("Invalid match found: %v", match)
+// detectModulePath records the module path declared by a generated go.mod so
+// imports of it can be rebased onto the base package.
+func (a *Agent) detectModulePath(tasks []FileTask) {
+	for _, task := range tasks {
+		if filepath.Base(task.Path) != "go.mod" {
 			continue
 		}
 
-		filePath := strings.TrimSpace(match[1])
-		code := strings.TrimSpace(match[2])
+		a.fileWriterMutex.Lock()
+		a.modulePath = detectModulePath(task.Content)
+		a.fileWriterMutex.Unlock()
+	}
+}
+
+// extractFiles splits a delimited model response into file tasks.
+func extractFiles(content string) []FileTask {
+	matches := codeBlockRegex.FindAllStringSubmatch(content, -1)
 
-		code = regexp.MustCompile("^```[a-zA-Z0-9]*\n").ReplaceAllString(code, "")
-		code = regexp.MustCompile("\n```$").ReplaceAllString(code, "")
+	var tasks []FileTask
+	for _, match := range matches {
 
-		a.taskQueue <- FileTask{
-			Path:    filePath,
-			Content: code,
+		if len(match) < 3 {
+			log.Printf("Invalid match found: %v", match)
+			continue
 		}
+
+		tasks = append(tasks, FileTask{
+			Path:    strings.TrimSpace(match[1]),
+			Content: stripFences(match[2]),
+		})
 	}
 
-	return nil
+	return tasks
+}
+
+// stripFences removes the markdown code fence models like to wrap code in.
+func stripFences(code string) string {
+	code = strings.TrimSpace(code)
+	code = openFenceRegex.ReplaceAllString(code, "")
+	return closeFenceRegex.ReplaceAllString(code, "")
 }
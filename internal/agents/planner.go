@@ -0,0 +1,337 @@
+package agents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"strings"
+	"sync"
+)
+
+const (
+	maxInterfaceBytes = 4000
+	maxInterfaceLines = 40
+)
+
+// PlannedFile is one entry of a generation plan. Files sharing a Group are
+// generated together in a single model call. DependsOn lists the paths of
+// files whose API this file uses.
+type PlannedFile struct {
+	Path           string   `json:"path"`
+	Responsibility string   `json:"responsibility"`
+	Group          string   `json:"group,omitempty"`
+	DependsOn      []string `json:"dependsOn,omitempty"`
+}
+
+// Plan is the list of files the planner decided the project needs.
+type Plan struct {
+	Files []PlannedFile `json:"files"`
+}
+
+type planUnit struct {
+	index int
+	files []PlannedFile
+	// deps are the indexes of earlier units the unit's files depend on.
+	deps []int
+}
+
+const plannerPrompt = `You are a software architect planning a {{LANGUAGE}} project before any code is written.
+Respond with a single JSON object and nothing else, in this shape:
+
+{"files": [{"path": "relative/path.ext", "responsibility": "what this file contains and exposes", "group": "optional name", "dependsOn": ["paths of files whose API this file uses"]}]}
+
+List EVERY file the project needs, including build, configuration and README files, with dependency manifests first and files that others depend on before the files that use them.
+In dependsOn, list only files that come earlier in the list.
+Give files that must be written together (for example a small package whose files share unexported helpers) the same group.
+Base package: {{BASE_PACKAGE}}
+{{EXTRA_PROMPT}}`
+
+// generatePlanned asks the model for a plan, then generates the planned
+// files across the agent's workers, giving each call the plan and the
+// interfaces of files generated so far. A unit waits for the units it
+// depends on, so their interfaces are always part of its prompt.
+func (a *Agent) generatePlanned(systemPrompt, prompt string) error {
+	plan, err := a.requestPlan(prompt)
+	if err != nil {
+		return err
+	}
+	a.plan = plan
+
+	if a.progressCallback != nil {
+		a.progressCallback("plan", fmt.Sprintf("Planned %d files", len(plan.Files)), "")
+	}
+
+	units := groupPlan(plan)
+	planJSON, _ := json.MarshalIndent(plan, "", "  ")
+
+	var (
+		mu        sync.Mutex
+		generated = make(map[string]string)
+		failed    int
+		done      int
+	)
+
+	// finished[i] is closed once unit i's files are in generated. Units
+	// only depend on earlier units, which the workers take first, so
+	// waiting for them can't deadlock.
+	finished := make([]chan struct{}, len(units))
+	for i := range finished {
+		finished[i] = make(chan struct{})
+	}
+
+	work := make([]unit, len(units))
+	for i, pu := range units {
+		work[i] = unit{
+			name: fmt.Sprintf("plan-%d", pu.index),
+			run: func(ctx context.Context) ([]FileTask, error) {
+				defer close(finished[i])
+
+				for _, dep := range pu.deps {
+					select {
+					case <-finished[dep]:
+					case <-ctx.Done():
+						return nil, ctx.Err()
+					}
+				}
+
+				if a.progressCallback != nil {
+					for _, f := range pu.files {
+						a.progressCallback("plan", "Generating planned file: "+f.Responsibility, f.Path)
+					}
+				}
+
+				mu.Lock()
+				interfaces := summarizeInterfaces(generated)
+				mu.Unlock()
+
+				tasks, err := a.generateUnit(systemPrompt, prompt, string(planJSON), interfaces, pu)
+
+				mu.Lock()
+				for _, task := range tasks {
+					generated[task.Path] = task.Content
+				}
+				mu.Unlock()
+
+				return tasks, err
+			},
+		}
+	}
+
+	a.runUnits(work, func(i int, r unitResult) {
+		mu.Lock()
+		done += len(units[i].files)
+		progress := fmt.Sprintf("(%d/%d)", done, len(plan.Files))
+		if r.err != nil {
+			failed++
+		}
+		mu.Unlock()
+
+		if a.progressCallback != nil {
+			for _, f := range units[i].files {
+				if r.err != nil {
+					a.progressCallback("plan", fmt.Sprintf("Failed to generate planned file %s: %v", progress, r.err), f.Path)
+				} else {
+					a.progressCallback("plan", "Generated planned file "+progress, f.Path)
+				}
+			}
+		}
+
+		for _, task := range r.tasks {
+			a.emitFile(task)
+		}
+	})
+
+	if failed == len(units) {
+		return errors.New("every planned file failed to generate")
+	}
+
+	return nil
+}
+
+// requestPlan asks the model for the JSON plan of the project.
+func (a *Agent) requestPlan(prompt string) (*Plan, error) {
+	tmpl := a.templates[a.selectedTmpl]
+
+	replacer := strings.NewReplacer(
+		"{{LANGUAGE}}", a.language,
+		"{{BASE_PACKAGE}}", a.basePackage,
+		"{{EXTRA_PROMPT}}", tmpl.Prompt,
+	)
+
+	res, err := a.openAI.Query(replacer.Replace(plannerPrompt), prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error querying OpenAI for a plan: %w", err)
+	}
+
+	plan, err := parsePlan(res.Choices[0].Message.Content)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing plan: %w", err)
+	}
+
+	return plan, nil
+}
+
+func parsePlan(content string) (*Plan, error) {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("no JSON object in response")
+	}
+
+	var plan Plan
+	if err := json.Unmarshal([]byte(content[start:end+1]), &plan); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	files := plan.Files[:0]
+	for _, f := range plan.Files {
+		f.Path = strings.TrimSpace(f.Path)
+		if f.Path == "" || seen[f.Path] {
+			continue
+		}
+		seen[f.Path] = true
+		files = append(files, f)
+	}
+	plan.Files = files
+
+	if len(plan.Files) == 0 {
+		return nil, errors.New("plan contains no files")
+	}
+
+	return &plan, nil
+}
+
+// groupPlan turns the plan into generation units, keeping plan order.
+// Dependencies on files of the same or a later unit are dropped.
+func groupPlan(plan *Plan) []planUnit {
+	var units []planUnit
+	groups := make(map[string]int)
+	unitOf := make(map[string]int)
+
+	for _, f := range plan.Files {
+		if f.Group != "" {
+			if i, ok := groups[f.Group]; ok {
+				units[i].files = append(units[i].files, f)
+				unitOf[f.Path] = i
+				continue
+			}
+			groups[f.Group] = len(units)
+		}
+		unitOf[f.Path] = len(units)
+		units = append(units, planUnit{index: len(units), files: []PlannedFile{f}})
+	}
+
+	for i := range units {
+		seen := make(map[int]bool)
+		for _, f := range units[i].files {
+			for _, p := range f.DependsOn {
+				dep, ok := unitOf[strings.TrimSpace(p)]
+				if !ok || dep >= i || seen[dep] {
+					continue
+				}
+				seen[dep] = true
+				units[i].deps = append(units[i].deps, dep)
+			}
+		}
+	}
+
+	return units
+}
+
+// generateUnit generates the files of one plan unit.
+func (a *Agent) generateUnit(systemPrompt, prompt, planJSON, interfaces string, unit planUnit) ([]FileTask, error) {
+	var b strings.Builder
+	b.WriteString(prompt)
+	b.WriteString("\n\nThe project is being generated file by file from this plan:\n")
+	b.WriteString(planJSON)
+
+	if interfaces != "" {
+		b.WriteString("\n\nThese files have already been generated. Use their exported API exactly as shown:\n")
+		b.WriteString(interfaces)
+	}
+
+	b.WriteString("\n\nGenerate ONLY the following file(s), using the required response format:\n")
+	for _, f := range unit.files {
+		fmt.Fprintf(&b, "- %s: %s\n", f.Path, f.Responsibility)
+	}
+
+	tasks, content, err := a.queryFiles(systemPrompt, b.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tasks) == 0 && len(unit.files) == 1 && a.Protocol() == ProtocolDelimited {
+		// The model skipped the delimiters and returned the bare file.
+		tasks = []FileTask{{Path: unit.files[0].Path, Content: stripFences(content)}}
+	}
+
+	if len(tasks) == 0 {
+		return nil, errors.New("response contained no files")
+	}
+
+	a.detectModulePath(tasks)
+
+	log.Printf("Generated plan unit %d (%d files)", unit.index, len(tasks))
+
+	return tasks, nil
+}
+
+// summarizeInterfaces renders the public surface of generated files so that
+// later calls can use them without the full source.
+func summarizeInterfaces(files map[string]string) string {
+	var b strings.Builder
+	for _, p := range sortedKeys(files) {
+		fmt.Fprintf(&b, "\n<file path=%q>\n%s\n</file>\n", p, summarizeInterface(p, files[p]))
+	}
+	return b.String()
+}
+
+func summarizeInterface(p, content string) string {
+	if isGoFile(p) {
+		if summary, err := goDeclarations(content); err == nil {
+			content = summary
+		}
+	} else {
+		lines := strings.Split(content, "\n")
+		if len(lines) > maxInterfaceLines {
+			content = strings.Join(lines[:maxInterfaceLines], "\n") + "\n..."
+		}
+	}
+
+	if len(content) > maxInterfaceBytes {
+		content = content[:maxInterfaceBytes] + "\n..."
+	}
+
+	return strings.TrimRight(content, "\n")
+}
+
+// goDeclarations prints a Go file with its function bodies removed.
+func goDeclarations(content string) (string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", content, parser.SkipObjectResolution)
+	if err != nil {
+		return "", err
+	}
+
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			fn.Body = nil
+		}
+	}
+	f.Comments = nil
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
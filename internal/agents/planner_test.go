@@ -0,0 +1,134 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroupPlanDependencies(t *testing.T) {
+	plan := &Plan{Files: []PlannedFile{
+		{Path: "go.mod"},
+		{Path: "store/store.go", Group: "store"},
+		{Path: "store/sql.go", Group: "store", DependsOn: []string{"store/store.go", "go.mod"}},
+		{Path: "api/api.go", DependsOn: []string{"store/sql.go", " store/store.go ", "main.go"}},
+		{Path: "main.go", DependsOn: []string{"api/api.go", "missing.go", "main.go"}},
+	}}
+
+	units := groupPlan(plan)
+
+	var got [][]int
+	for _, u := range units {
+		got = append(got, u.deps)
+	}
+	// api/api.go's dependency on the later main.go is dropped, as are the
+	// store group's dependency on itself and unknown paths.
+	want := [][]int{nil, {0}, {1}, {2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unit dependencies = %v, want %v", got, want)
+	}
+}
+
+// unitModel answers the planner with files and each unit request with the
+// files it asks for, holding back the answer for slow files.
+type unitModel struct {
+	plan  Plan
+	files map[string]string
+	slow  string
+
+	mutex   sync.Mutex
+	prompts map[string]string
+}
+
+func (m *unitModel) RoundTrip(r *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var request struct {
+		Messages []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, err
+	}
+	prompt := request.Messages[len(request.Messages)-1].Content
+
+	var content string
+	if strings.Contains(string(body), "software architect") {
+		b, _ := json.Marshal(m.plan)
+		content = string(b)
+	} else {
+		for _, f := range m.plan.Files {
+			if !strings.Contains(prompt, "- "+f.Path+":") {
+				continue
+			}
+			if f.Path == m.slow {
+				time.Sleep(100 * time.Millisecond)
+			}
+			m.mutex.Lock()
+			m.prompts[f.Path] = prompt
+			m.mutex.Unlock()
+			content += fmt.Sprintf("---FILE_PATH: %s\n%s---END_FILE\n", f.Path, m.files[f.Path])
+		}
+	}
+
+	reply, _ := json.Marshal(map[string]any{
+		"choices": []any{map[string]any{"message": map[string]any{"content": content}}},
+		"usage":   map[string]any{"total_tokens": 10},
+	})
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(string(reply))),
+		Request:    r,
+	}, nil
+}
+
+func TestPlannedUnitsWaitForDependencies(t *testing.T) {
+	model := &unitModel{
+		plan: Plan{Files: []PlannedFile{
+			{Path: "greet.go", Responsibility: "Greet"},
+			{Path: "util.go", Responsibility: "helpers"},
+			{Path: "main.go", Responsibility: "entry point", DependsOn: []string{"greet.go"}},
+		}},
+		files: map[string]string{
+			"greet.go": "package main\n\nfunc Greet(name string) string { return \"hello \" + name }\n",
+			"util.go":  "package main\n",
+			"main.go":  "package main\n\nfunc main() { println(Greet(\"you\")) }\n",
+		},
+		slow:    "greet.go",
+		prompts: make(map[string]string),
+	}
+
+	ctx := context.Background()
+	client := NewOpenAI(ctx, "test-key", "gpt-4o-mini", &http.Client{Transport: model})
+	agent, err := NewAgent(ctx, client, t.TempDir(), "", "go-gin", "go", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent.SetPlanning(true)
+	agent.SetAutoFix(false)
+	agent.SetDryRun(true)
+
+	agent.Start()
+	err = agent.GenerateCode("Greet someone")
+	agent.Stop()
+	if err != nil {
+		t.Fatalf("GenerateCode: %v", err)
+	}
+
+	if prompt := model.prompts["main.go"]; !strings.Contains(prompt, "func Greet(name string) string") {
+		t.Errorf("main.go was generated without the interface of greet.go:\n%s", prompt)
+	}
+}
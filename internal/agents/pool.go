@@ -0,0 +1,76 @@
+package agents
+
+import (
+	"context"
+	"sync"
+)
+
+// unit is a piece of generation work, such as one planned file, a repair
+// round or a test file, executed by the agent's workers.
+type unit struct {
+	name string
+	run  func(ctx context.Context) ([]FileTask, error)
+}
+
+type unitResult struct {
+	tasks []FileTask
+	err   error
+}
+
+type unitJob struct {
+	unit unit
+	done func(unitResult)
+}
+
+// runUnits executes units concurrently on the agent's workers. Results are
+// handed to commit one at a time in submission order, as soon as every
+// earlier unit has been committed, so output stays deterministic however
+// the calls interleave.
+func (a *Agent) runUnits(units []unit, commit func(i int, r unitResult)) {
+	if a.workerCount < 1 {
+		for i, u := range units {
+			tasks, err := u.run(a.ctx)
+			commit(i, unitResult{tasks: tasks, err: err})
+		}
+		return
+	}
+
+	var (
+		mu      sync.Mutex
+		results = make([]*unitResult, len(units))
+		next    int
+		wg      sync.WaitGroup
+	)
+
+	// flush commits the finished prefix. Holding mu while committing keeps
+	// commits strictly ordered.
+	flush := func() {
+		for next < len(results) && results[next] != nil {
+			commit(next, *results[next])
+			next++
+		}
+	}
+
+	wg.Add(len(units))
+	for i, u := range units {
+		job := unitJob{
+			unit: u,
+			done: func(r unitResult) {
+				defer wg.Done()
+
+				mu.Lock()
+				defer mu.Unlock()
+				results[i] = &r
+				flush()
+			},
+		}
+
+		select {
+		case a.unitQueue <- job:
+		case <-a.ctx.Done():
+			job.done(unitResult{err: a.ctx.Err()})
+		}
+	}
+
+	wg.Wait()
+}
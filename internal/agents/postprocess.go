@@ -0,0 +1,326 @@
+package agents
+
+import (
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ProcessContext describes the file a post-processor is running against.
+type ProcessContext struct {
+	Path        string
+	Language    string
+	BasePackage string
+	// ModulePath is the module path the model declared in its go.mod, which
+	// may differ from BasePackage.
+	ModulePath string
+}
+
+// PostProcessor rewrites the content of a generated file before it is
+// written to disk.
+type PostProcessor func(pc ProcessContext, content string) (string, error)
+
+// PostProcessorSpec lets a project template add processors to the pipeline,
+// either by naming a registered processor or by declaring a regex rewrite.
+type PostProcessorSpec struct {
+	Name    string `json:"name"`
+	Files   string `json:"files,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	Replace string `json:"replace,omitempty"`
+}
+
+type namedProcessor struct {
+	name string
+	fn   PostProcessor
+}
+
+var (
+	postProcessorsMu sync.RWMutex
+
+	postProcessors = map[string]PostProcessor{
+		"normalize-line-endings": normalizeLineEndings,
+		"trailing-newline":       ensureTrailingNewline,
+		"go-mod":                 fixGoModule,
+		"go-package":             fixGoPackage,
+		"go-imports":             rewriteGoImports,
+		"gofmt":                  formatGo,
+	}
+
+	languagePipelines = map[string][]string{
+		"default": {"normalize-line-endings", "trailing-newline"},
+		"go":      {"normalize-line-endings", "go-mod", "go-package", "go-imports", "gofmt", "trailing-newline"},
+	}
+
+	moduleLineRegex = regexp.MustCompile(`(?m)^module\s+(\S+)`)
+)
+
+// RegisterPostProcessor makes a processor available to templates under name,
+// replacing any processor already registered with that name.
+func RegisterPostProcessor(name string, p PostProcessor) {
+	postProcessorsMu.Lock()
+	defer postProcessorsMu.Unlock()
+	postProcessors[name] = p
+}
+
+// ListPostProcessors returns the names of all registered processors.
+func ListPostProcessors() []string {
+	postProcessorsMu.RLock()
+	defer postProcessorsMu.RUnlock()
+
+	names := make([]string, 0, len(postProcessors))
+	for name := range postProcessors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupPostProcessor(name string) (PostProcessor, bool) {
+	postProcessorsMu.RLock()
+	defer postProcessorsMu.RUnlock()
+	p, ok := postProcessors[name]
+	return p, ok
+}
+
+// buildPipeline resolves the processors for the agent's language followed by
+// any processors declared by the template.
+func (a *Agent) buildPipeline(tmpl ProjectTemplate) ([]namedProcessor, error) {
+	names, ok := languagePipelines[a.language]
+	if !ok {
+		names = languagePipelines["default"]
+	}
+
+	var pipeline []namedProcessor
+	for _, name := range names {
+		p, ok := lookupPostProcessor(name)
+		if !ok {
+			return nil, fmt.Errorf("post-processor %s not registered", name)
+		}
+		pipeline = append(pipeline, namedProcessor{name: name, fn: p})
+	}
+
+	for _, spec := range tmpl.PostProcessors {
+		p, err := spec.processor()
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", tmpl.Name, err)
+		}
+		pipeline = append(pipeline, namedProcessor{name: spec.Name, fn: p})
+	}
+
+	return pipeline, nil
+}
+
+func (s PostProcessorSpec) processor() (PostProcessor, error) {
+	var p PostProcessor
+
+	if s.Pattern != "" {
+		rx, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("post-processor %s: invalid pattern: %w", s.Name, err)
+		}
+		p = func(pc ProcessContext, content string) (string, error) {
+			return rx.ReplaceAllString(content, s.Replace), nil
+		}
+	} else {
+		registered, ok := lookupPostProcessor(s.Name)
+		if !ok {
+			return nil, fmt.Errorf("post-processor %s not registered", s.Name)
+		}
+		p = registered
+	}
+
+	if s.Files == "" {
+		return p, nil
+	}
+
+	if _, err := path.Match(s.Files, ""); err != nil {
+		return nil, fmt.Errorf("post-processor %s: invalid files pattern: %w", s.Name, err)
+	}
+
+	return func(pc ProcessContext, content string) (string, error) {
+		if ok, _ := path.Match(s.Files, path.Base(filepath.ToSlash(pc.Path))); !ok {
+			return content, nil
+		}
+		return p(pc, content)
+	}, nil
+}
+
+// postProcess runs content through the agent's pipeline. A failing processor
+// is logged and skipped so that one bad file never blocks the write.
+func (a *Agent) postProcess(filePath, content string) string {
+	a.fileWriterMutex.Lock()
+	pc := ProcessContext{
+		Path:        filePath,
+		Language:    a.language,
+		BasePackage: a.basePackage,
+		ModulePath:  a.modulePath,
+	}
+	a.fileWriterMutex.Unlock()
+
+	for _, p := range a.pipeline {
+		out, err := p.fn(pc, content)
+		if err != nil {
+			log.Printf("WARNING: post-processor %s failed on %s: %v", p.name, filePath, err)
+			continue
+		}
+		content = out
+	}
+
+	return content
+}
+
+func normalizeLineEndings(pc ProcessContext, content string) (string, error) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	return strings.ReplaceAll(content, "\r", "\n"), nil
+}
+
+func ensureTrailingNewline(pc ProcessContext, content string) (string, error) {
+	if content == "" || strings.HasSuffix(content, "\n") {
+		return content, nil
+	}
+	return content + "\n", nil
+}
+
+func isGoFile(p string) bool {
+	return strings.HasSuffix(p, ".go")
+}
+
+func formatGo(pc ProcessContext, content string) (string, error) {
+	if !isGoFile(pc.Path) {
+		return content, nil
+	}
+
+	formatted, err := format.Source([]byte(content))
+	if err != nil {
+		return content, fmt.Errorf("gofmt: %w", err)
+	}
+
+	return string(formatted), nil
+}
+
+// fixGoModule points the module directive of a generated go.mod at the base
+// package.
+func fixGoModule(pc ProcessContext, content string) (string, error) {
+	if path.Base(filepath.ToSlash(pc.Path)) != "go.mod" || pc.BasePackage == "" {
+		return content, nil
+	}
+
+	return moduleLineRegex.ReplaceAllLiteralString(content, "module "+pc.BasePackage), nil
+}
+
+// goPackageName derives the package name Go tooling expects for a directory.
+func goPackageName(dir string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(dir) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+
+	name := b.String()
+	if name != "" && unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// fixGoPackage rewrites the package clause so it matches the file's
+// directory. Files in the project root and main packages are left alone.
+func fixGoPackage(pc ProcessContext, content string) (string, error) {
+	if !isGoFile(pc.Path) {
+		return content, nil
+	}
+
+	dir := path.Dir(filepath.ToSlash(pc.Path))
+	if dir == "." {
+		return content, nil
+	}
+
+	want := goPackageName(path.Base(dir))
+	if want == "" {
+		return content, nil
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, pc.Path, content, parser.PackageClauseOnly)
+	if err != nil {
+		return content, fmt.Errorf("parsing package clause: %w", err)
+	}
+
+	name := f.Name.Name
+	if name == "main" || name == want || name == want+"_test" {
+		return content, nil
+	}
+
+	offset := fset.Position(f.Name.Pos()).Offset
+	log.Printf("Rewriting package %s to %s in %s", name, want, pc.Path)
+
+	return content[:offset] + want + content[offset+len(name):], nil
+}
+
+// rewriteGoImports moves imports of the model's invented module path onto the
+// base package.
+func rewriteGoImports(pc ProcessContext, content string) (string, error) {
+	if !isGoFile(pc.Path) || pc.ModulePath == "" || pc.ModulePath == pc.BasePackage || pc.BasePackage == "" {
+		return content, nil
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, pc.Path, content, parser.ImportsOnly)
+	if err != nil {
+		return content, fmt.Errorf("parsing imports: %w", err)
+	}
+
+	// Rewrite from the end of the file so earlier offsets stay valid.
+	for i := len(f.Imports) - 1; i >= 0; i-- {
+		spec := f.Imports[i]
+
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+
+		rewritten, ok := rebaseImport(importPath, pc.ModulePath, pc.BasePackage)
+		if !ok {
+			continue
+		}
+
+		start := fset.Position(spec.Path.Pos()).Offset
+		end := fset.Position(spec.Path.End()).Offset
+		content = content[:start] + strconv.Quote(rewritten) + content[end:]
+	}
+
+	return content, nil
+}
+
+func rebaseImport(importPath, from, to string) (string, bool) {
+	if importPath == from {
+		return to, true
+	}
+
+	if rest, ok := strings.CutPrefix(importPath, from+"/"); ok {
+		return to + "/" + rest, true
+	}
+
+	return "", false
+}
+
+// detectModulePath returns the module path declared in a go.mod file.
+func detectModulePath(goMod string) string {
+	m := moduleLineRegex.FindStringSubmatch(goMod)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
@@ -0,0 +1,44 @@
+package agents
+
+import (
+	"sync"
+	"testing"
+)
+
+// Plan units detect the module path from their go.mod while other units
+// post-process their files, so both sides must go through fileWriterMutex.
+func TestPostProcessWhileDetectingModulePath(t *testing.T) {
+	a := &Agent{
+		language:    "go",
+		basePackage: "example.com/shop",
+		files:       make(map[string]string),
+	}
+	pipeline, err := a.buildPipeline(ProjectTemplate{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.pipeline = pipeline
+
+	const source = "package main\n\nimport \"github.com/acme/shop/store\"\n"
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range 50 {
+			a.detectModulePath([]FileTask{{Path: "go.mod", Content: "module github.com/acme/shop\n"}})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 50 {
+			a.postProcess("main.go", source)
+		}
+	}()
+	wg.Wait()
+
+	want := "package main\n\nimport \"example.com/shop/store\"\n"
+	if got := a.postProcess("main.go", source); got != want {
+		t.Errorf("postProcess after detecting the module path = %q, want %q", got, want)
+	}
+}
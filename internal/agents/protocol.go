@@ -0,0 +1,248 @@
+package agents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Response protocols the model can be asked to answer with.
+const (
+	// ProtocolDelimited asks for files between ---FILE_PATH and ---END_FILE
+	// markers.
+	ProtocolDelimited = "delimited"
+	// ProtocolJSONSchema asks for JSON matching filesSchema via
+	// response_format.
+	ProtocolJSONSchema = "json_schema"
+	// ProtocolTools forces a call of a write_files tool whose arguments
+	// match filesSchema.
+	ProtocolTools = "tools"
+	// ProtocolJSON picks the best structured protocol the model supports.
+	ProtocolJSON = "json"
+)
+
+const writeFilesTool = "write_files"
+
+const structuredInstructions = `
+
+RESPONSE FORMAT OVERRIDE: Ignore the ---FILE_PATH/---END_FILE format described above. Return every file as an entry of the "files" array of the JSON response, with its path, its complete content and its language. Put anything you want to say besides code in "notes".`
+
+var filesSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"files": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path":     map[string]interface{}{"type": "string"},
+					"content":  map[string]interface{}{"type": "string"},
+					"language": map[string]interface{}{"type": "string"},
+				},
+				"required":             []string{"path", "content", "language"},
+				"additionalProperties": false,
+			},
+		},
+		"notes": map[string]interface{}{"type": "string"},
+	},
+	"required":             []string{"files", "notes"},
+	"additionalProperties": false,
+}
+
+// jsonSchemaModels are the model families known to support json_schema
+// response formats when a model is missing from the catalogue. Other models
+// use tool calling.
+var jsonSchemaModels = []string{"gpt-4o", "gpt-4.1", "gpt-5", "o1", "o3", "o4"}
+
+var errStructuredUnsupported = errors.New("structured output not supported by model")
+
+// filesResponse is the JSON document the structured protocols return.
+type filesResponse struct {
+	Files []struct {
+		Path     string `json:"path"`
+		Content  string `json:"content"`
+		Language string `json:"language"`
+	} `json:"files"`
+	Notes string `json:"notes"`
+}
+
+// QueryStructured asks for a response matching the files schema using the
+// given structured protocol and returns the raw JSON payload.
+func (o *OpenAPI) QueryStructured(systemPrompt, prompt, protocol string) (string, error) {
+	var extra map[string]interface{}
+
+	switch protocol {
+	case ProtocolJSONSchema:
+		extra = map[string]interface{}{
+			"response_format": map[string]interface{}{
+				"type": "json_schema",
+				"json_schema": map[string]interface{}{
+					"name":   "generated_files",
+					"strict": true,
+					"schema": filesSchema,
+				},
+			},
+		}
+	case ProtocolTools:
+		extra = map[string]interface{}{
+			"tools": []map[string]interface{}{{
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":        writeFilesTool,
+					"description": "Write the files of the generated project",
+					"parameters":  filesSchema,
+					"strict":      true,
+				},
+			}},
+			"tool_choice": map[string]interface{}{
+				"type":     "function",
+				"function": map[string]string{"name": writeFilesTool},
+			},
+		}
+	default:
+		return "", fmt.Errorf("unknown structured protocol %s", protocol)
+	}
+
+	res, err := o.query(systemPrompt, prompt, extra)
+	if err != nil {
+		if res.Error != nil && rejectsStructured(res.Error.Param, res.Error.Message) {
+			return "", fmt.Errorf("%w: %s", errStructuredUnsupported, res.Error.Message)
+		}
+		return "", err
+	}
+
+	msg := res.Choices[0].Message
+	for _, call := range msg.ToolCalls {
+		if call.Function.Name == writeFilesTool {
+			return call.Function.Arguments, nil
+		}
+	}
+
+	return msg.Content, nil
+}
+
+func rejectsStructured(param, message string) bool {
+	if param == "response_format" || strings.HasPrefix(param, "tools") || param == "tool_choice" {
+		return true
+	}
+
+	message = strings.ToLower(message)
+	return strings.Contains(message, "response_format") || strings.Contains(message, "json_schema") ||
+		strings.Contains(message, "tools")
+}
+
+// resolveProtocol validates a protocol name and picks the structured
+// protocol for the model when asked for plain json.
+func resolveProtocol(protocol, model string) (string, error) {
+	switch protocol {
+	case "", ProtocolDelimited:
+		return ProtocolDelimited, nil
+	case ProtocolJSONSchema, ProtocolTools:
+		return protocol, nil
+	case ProtocolJSON:
+		if info, ok := LookupModel(model); ok {
+			if info.JSONMode {
+				return ProtocolJSONSchema, nil
+			}
+			return ProtocolTools, nil
+		}
+		for _, prefix := range jsonSchemaModels {
+			if strings.HasPrefix(model, prefix) {
+				return ProtocolJSONSchema, nil
+			}
+		}
+		return ProtocolTools, nil
+	}
+
+	return "", fmt.Errorf("unknown response protocol %q (expected delimited, json, json_schema or tools)", protocol)
+}
+
+// SetProtocol selects how the model is asked to return files.
+func (a *Agent) SetProtocol(protocol string) error {
+	resolved, err := resolveProtocol(protocol, a.openAI.model)
+	if err != nil {
+		return err
+	}
+
+	a.fileWriterMutex.Lock()
+	a.protocol = resolved
+	a.fileWriterMutex.Unlock()
+
+	return nil
+}
+
+// Protocol returns the response protocol in use. It changes to delimited
+// when the provider rejects a structured request.
+func (a *Agent) Protocol() string {
+	a.fileWriterMutex.Lock()
+	defer a.fileWriterMutex.Unlock()
+
+	if a.protocol == "" {
+		return ProtocolDelimited
+	}
+	return a.protocol
+}
+
+// queryFiles asks the model for files using the agent's protocol. It returns
+// the parsed files along with the raw reply so callers can salvage replies
+// that contain no recognisable files.
+func (a *Agent) queryFiles(systemPrompt, prompt string) ([]FileTask, string, error) {
+	protocol := a.Protocol()
+
+	if protocol != ProtocolDelimited {
+		payload, err := a.openAI.QueryStructured(systemPrompt+structuredInstructions, prompt, protocol)
+		if err == nil {
+			return a.parseStructured(payload), payload, nil
+		}
+		if !errors.Is(err, errStructuredUnsupported) {
+			return nil, "", fmt.Errorf("error querying OpenAI: %w", err)
+		}
+
+		log.Printf("Falling back to delimited responses: %v", err)
+		a.fileWriterMutex.Lock()
+		a.protocol = ProtocolDelimited
+		a.fileWriterMutex.Unlock()
+
+		if a.progressCallback != nil {
+			a.progressCallback("protocol", "Model does not support "+protocol+", falling back to delimited responses", "")
+		}
+	}
+
+	res, err := a.openAI.Query(systemPrompt, prompt)
+	if err != nil {
+		return nil, "", fmt.Errorf("error querying OpenAI: %w", err)
+	}
+
+	content := res.Choices[0].Message.Content
+	return extractFiles(content), content, nil
+}
+
+// parseStructured decodes a structured reply, falling back to the delimiter
+// parser when the model did not return valid JSON.
+func (a *Agent) parseStructured(payload string) []FileTask {
+	var resp filesResponse
+	if err := json.Unmarshal([]byte(stripFences(payload)), &resp); err != nil {
+		log.Printf("WARNING: structured response is not valid JSON, trying delimiters: %v", err)
+		return extractFiles(payload)
+	}
+
+	if resp.Notes != "" {
+		log.Printf("Model notes: %s", resp.Notes)
+		if a.progressCallback != nil {
+			a.progressCallback("notes", resp.Notes, "")
+		}
+	}
+
+	tasks := make([]FileTask, 0, len(resp.Files))
+	for _, f := range resp.Files {
+		p := strings.TrimSpace(f.Path)
+		if p == "" {
+			continue
+		}
+		tasks = append(tasks, FileTask{Path: p, Content: f.Content})
+	}
+
+	return tasks
+}
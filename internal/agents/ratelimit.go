@@ -0,0 +1,121 @@
+package agents
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProviderConcurrency = 4
+	maxRateLimitRetries        = 3
+)
+
+// providerLimiter bounds the number of in-flight requests to one provider
+// and shares rate-limit back-off between every agent talking to it.
+type providerLimiter struct {
+	sem chan struct{}
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+var (
+	providerLimitersMu sync.Mutex
+	providerLimiters   = make(map[string]*providerLimiter)
+)
+
+// SetProviderConcurrency sets how many requests may be in flight to a
+// provider at once across all agents. It only affects requests started
+// after the call.
+func SetProviderConcurrency(provider string, n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	providerLimitersMu.Lock()
+	defer providerLimitersMu.Unlock()
+
+	providerLimiters[provider] = &providerLimiter{sem: make(chan struct{}, n)}
+}
+
+func limiterFor(provider string) *providerLimiter {
+	providerLimitersMu.Lock()
+	defer providerLimitersMu.Unlock()
+
+	l, ok := providerLimiters[provider]
+	if !ok {
+		l = &providerLimiter{sem: make(chan struct{}, defaultProviderConcurrency)}
+		providerLimiters[provider] = l
+	}
+	return l
+}
+
+// acquire waits for any shared back-off to pass and for a free slot.
+func (l *providerLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		wait := time.Until(l.pausedUntil)
+		l.mu.Unlock()
+
+		if wait <= 0 {
+			break
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *providerLimiter) release() {
+	<-l.sem
+}
+
+// pause holds back every request to the provider for d.
+func (l *providerLimiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// observe pauses the provider when its rate-limit headers say the current
+// window is exhausted.
+func (l *providerLimiter) observe(h http.Header) {
+	for _, kind := range []string{"requests", "tokens"} {
+		if h.Get("x-ratelimit-remaining-"+kind) != "0" {
+			continue
+		}
+		if d, err := time.ParseDuration(h.Get("x-ratelimit-reset-" + kind)); err == nil {
+			l.pause(d)
+		}
+	}
+}
+
+// retryDelay works out how long to wait before retrying a rate-limited
+// request, falling back to exponential back-off.
+func retryDelay(h http.Header, attempt int) time.Duration {
+	if secs, err := strconv.Atoi(h.Get("Retry-After")); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+
+	if d, err := time.ParseDuration(h.Get("x-ratelimit-reset-requests")); err == nil && d > 0 {
+		return d
+	}
+
+	return time.Duration(1<<attempt) * time.Second
+}
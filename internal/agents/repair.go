@@ -0,0 +1,103 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"log"
+)
+
+const repairPrompt = `The following file from a generated project does not compile.
+
+Error:
+%s
+
+Return the corrected file in full using the required response format, with the same path. Do not change anything unrelated to the error.
+
+---FILE_PATH: %s
+%s
+---END_FILE`
+
+// SetRepairRounds sets how many rounds of asking the model to fix files
+// that fail to parse are run after generation.
+func (a *Agent) SetRepairRounds(rounds int) {
+	a.repairRounds = rounds
+}
+
+// repair runs up to repairRounds rounds in which every broken file is sent
+// back to the model, one unit per file.
+func (a *Agent) repair(systemPrompt string) {
+	for round := 1; round <= a.repairRounds; round++ {
+		broken := a.brokenFiles()
+		if len(broken) == 0 {
+			return
+		}
+
+		if a.progressCallback != nil {
+			a.progressCallback("repair", fmt.Sprintf("Repair round %d: %d file(s) failed to parse", round, len(broken)), "")
+		}
+
+		paths := sortedKeys(broken)
+		work := make([]unit, len(paths))
+		for i, p := range paths {
+			work[i] = unit{
+				name: "repair-" + p,
+				run: func(ctx context.Context) ([]FileTask, error) {
+					return a.repairFile(systemPrompt, p, broken[p])
+				},
+			}
+		}
+
+		a.runUnits(work, func(i int, r unitResult) {
+			if r.err != nil {
+				log.Printf("Repair of %s failed: %v", paths[i], r.err)
+				return
+			}
+
+			for _, task := range r.tasks {
+				if task.Path != paths[i] {
+					continue
+				}
+				if err := a.writeFile(task); err != nil {
+					log.Printf("Error writing repaired file %s: %v", task.Path, err)
+					continue
+				}
+				if a.progressCallback != nil {
+					a.progressCallback("repair", "Repaired file", task.Path)
+				}
+			}
+		})
+	}
+}
+
+// brokenFiles maps every generated Go file that fails to parse to its error.
+func (a *Agent) brokenFiles() map[string]error {
+	broken := make(map[string]error)
+
+	for p, content := range a.Files() {
+		if !isGoFile(p) {
+			continue
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), p, content, parser.AllErrors); err != nil {
+			broken[p] = err
+		}
+	}
+
+	return broken
+}
+
+func (a *Agent) repairFile(systemPrompt, p string, parseErr error) ([]FileTask, error) {
+	content := a.Files()[p]
+
+	tasks, _, err := a.queryFiles(systemPrompt, fmt.Sprintf(repairPrompt, parseErr, p, content))
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, errors.New("response contained no files")
+	}
+
+	return tasks, nil
+}
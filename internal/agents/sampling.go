@@ -0,0 +1,174 @@
+package agents
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SamplingParams are the optional generation parameters sent with every
+// request. Unset fields are left to the provider's defaults.
+type SamplingParams struct {
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	MaxTokens       *int     `json:"maxTokens,omitempty"`
+	Seed            *int64   `json:"seed,omitempty"`
+	Stop            []string `json:"stop,omitempty"`
+	ReasoningEffort string   `json:"reasoningEffort,omitempty"`
+}
+
+// samplingValidators check parameters against what each provider accepts.
+var samplingValidators = map[string]func(model string, p SamplingParams) error{
+	ProviderOpenAI: validateOpenAISampling,
+}
+
+// reasoningModels are the OpenAI model families that take reasoning_effort
+// and max_completion_tokens instead of temperature, top_p and max_tokens.
+// They're used for models missing from the catalogue.
+var reasoningModels = []string{"o1", "o3", "o4", "gpt-5"}
+
+func isReasoningModel(model string) bool {
+	if info, ok := LookupModel(model); ok {
+		return info.Reasoning
+	}
+
+	for _, prefix := range reasoningModels {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// merge fills the fields p leaves unset from defaults.
+func (p SamplingParams) merge(defaults *SamplingParams) SamplingParams {
+	if defaults == nil {
+		return p
+	}
+
+	if p.Temperature == nil {
+		p.Temperature = defaults.Temperature
+	}
+	if p.TopP == nil {
+		p.TopP = defaults.TopP
+	}
+	if p.MaxTokens == nil {
+		p.MaxTokens = defaults.MaxTokens
+	}
+	if p.Seed == nil {
+		p.Seed = defaults.Seed
+	}
+	if p.Stop == nil {
+		p.Stop = defaults.Stop
+	}
+	if p.ReasoningEffort == "" {
+		p.ReasoningEffort = defaults.ReasoningEffort
+	}
+
+	return p
+}
+
+// Validate checks the parameters against the limits of a provider's model.
+func (p SamplingParams) Validate(provider, model string) error {
+	validate, ok := samplingValidators[provider]
+	if !ok {
+		return fmt.Errorf("unknown provider %s", provider)
+	}
+	return validate(model, p)
+}
+
+func validateOpenAISampling(model string, p SamplingParams) error {
+	var errs []error
+
+	reasoning := isReasoningModel(model)
+
+	if p.Temperature != nil {
+		if reasoning {
+			errs = append(errs, fmt.Errorf("temperature is not supported by %s", model))
+		} else if *p.Temperature < 0 || *p.Temperature > 2 {
+			errs = append(errs, errors.New("temperature must be between 0 and 2"))
+		}
+	}
+
+	if p.TopP != nil {
+		if reasoning {
+			errs = append(errs, fmt.Errorf("topP is not supported by %s", model))
+		} else if *p.TopP <= 0 || *p.TopP > 1 {
+			errs = append(errs, errors.New("topP must be greater than 0 and at most 1"))
+		}
+	}
+
+	if p.MaxTokens != nil {
+		if *p.MaxTokens < 1 {
+			errs = append(errs, errors.New("maxTokens must be positive"))
+		} else if info, ok := LookupModel(model); ok && info.MaxOutputTokens > 0 && *p.MaxTokens > info.MaxOutputTokens {
+			errs = append(errs, fmt.Errorf("maxTokens must not exceed %d for %s", info.MaxOutputTokens, model))
+		}
+	}
+
+	if len(p.Stop) > 4 {
+		errs = append(errs, errors.New("at most 4 stop sequences are allowed"))
+	}
+	for _, s := range p.Stop {
+		if s == "" {
+			errs = append(errs, errors.New("stop sequences must not be empty"))
+			break
+		}
+	}
+
+	switch p.ReasoningEffort {
+	case "":
+	case "minimal", "low", "medium", "high":
+		if !reasoning {
+			errs = append(errs, fmt.Errorf("reasoningEffort is not supported by %s", model))
+		}
+	default:
+		errs = append(errs, errors.New("reasoningEffort must be minimal, low, medium or high"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// apply adds the parameters to an OpenAI request body.
+func (p SamplingParams) apply(request map[string]interface{}, model string) {
+	if p.Temperature != nil {
+		request["temperature"] = *p.Temperature
+	}
+	if p.TopP != nil {
+		request["top_p"] = *p.TopP
+	}
+	if p.MaxTokens != nil {
+		if isReasoningModel(model) {
+			request["max_completion_tokens"] = *p.MaxTokens
+		} else {
+			request["max_tokens"] = *p.MaxTokens
+		}
+	}
+	if p.Seed != nil {
+		request["seed"] = *p.Seed
+	}
+	if len(p.Stop) > 0 {
+		request["stop"] = p.Stop
+	}
+	if p.ReasoningEffort != "" {
+		request["reasoning_effort"] = p.ReasoningEffort
+	}
+}
+
+// SetSampling sets the sampling parameters for the agent's requests. Fields
+// left unset fall back to the template's defaults.
+func (a *Agent) SetSampling(p SamplingParams) error {
+	effective := p.merge(a.templates[a.selectedTmpl].Sampling)
+	if err := effective.Validate(a.openAI.provider, a.openAI.model); err != nil {
+		return fmt.Errorf("invalid sampling parameters: %w", err)
+	}
+
+	a.sampling = p
+	a.openAI.sampling = effective
+	return nil
+}
+
+// Sampling returns the sampling parameters sent with the agent's requests.
+func (a *Agent) Sampling() SamplingParams {
+	return a.openAI.sampling
+}
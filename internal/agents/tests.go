@@ -0,0 +1,174 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const testPrompt = `Write unit tests for the file below, which is part of a generated %s project.
+
+Use %s. Put the tests in exactly this file: %s
+Cover the exported behaviour of the file, including error cases. Only use dependencies the project already declares, plus the test framework.
+Return only the test file, using the required response format.
+
+The project contains these files:
+%s
+
+---FILE_PATH: %s
+%s
+---END_FILE`
+
+var testFrameworks = map[string]string{
+	"go":         "the standard library testing package with table-driven tests",
+	"python":     "pytest",
+	"javascript": "Jest",
+	"java":       "JUnit 5",
+}
+
+// SetWithTests enables the test generation stage, which asks the model for
+// tests for every generated source file.
+func (a *Agent) SetWithTests(withTests bool) {
+	a.withTests = withTests
+}
+
+// generateTests runs one unit per source file and writes the resulting test
+// files next to the code in the language's conventional layout.
+func (a *Agent) generateTests(systemPrompt string) {
+	files := a.Files()
+
+	var sources, targets []string
+	claimed := make(map[string]bool)
+	for _, p := range sortedKeys(files) {
+		target, ok := testPathFor(a.language, p)
+		if !ok || claimed[target] {
+			continue
+		}
+		if _, exists := files[target]; exists {
+			continue
+		}
+		claimed[target] = true
+		sources = append(sources, p)
+		targets = append(targets, target)
+	}
+
+	if len(sources) == 0 {
+		return
+	}
+
+	if a.progressCallback != nil {
+		a.progressCallback("test", fmt.Sprintf("Generating tests for %d file(s)", len(sources)), "")
+	}
+
+	listing := strings.Join(sortedKeys(files), "\n")
+
+	work := make([]unit, len(sources))
+	for i := range sources {
+		work[i] = unit{
+			name: "test-" + sources[i],
+			run: func(ctx context.Context) ([]FileTask, error) {
+				return a.generateTestFile(systemPrompt, listing, sources[i], targets[i], files[sources[i]])
+			},
+		}
+	}
+
+	a.runUnits(work, func(i int, r unitResult) {
+		if r.err != nil {
+			log.Printf("Test generation for %s failed: %v", sources[i], r.err)
+			if a.progressCallback != nil {
+				a.progressCallback("test", "Test generation failed: "+r.err.Error(), targets[i])
+			}
+			return
+		}
+
+		for _, task := range r.tasks {
+			a.emit(task, "test")
+
+			a.fileWriterMutex.Lock()
+			a.tests = append(a.tests, task.Path)
+			a.fileWriterMutex.Unlock()
+		}
+	})
+}
+
+func (a *Agent) generateTestFile(systemPrompt, listing, source, target, content string) ([]FileTask, error) {
+	framework, ok := testFrameworks[a.language]
+	if !ok {
+		framework = "the language's standard test framework"
+	}
+
+	prompt := fmt.Sprintf(testPrompt, a.language, framework, target, listing, source, content)
+
+	tasks, reply, err := a.queryFiles(systemPrompt, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, task := range tasks {
+		if task.Path == target {
+			return []FileTask{task}, nil
+		}
+	}
+
+	// Accept a bare reply as the test file, as long as it's not empty.
+	if body := stripFences(reply); body != "" && len(tasks) == 0 && a.Protocol() == ProtocolDelimited {
+		return []FileTask{{Path: target, Content: body}}, nil
+	}
+
+	return nil, errors.New("response did not contain the requested test file")
+}
+
+// testPathFor maps a source file to where its tests conventionally live. It
+// returns false for files that are not source code or are tests already.
+func testPathFor(language, p string) (string, bool) {
+	p = filepath.ToSlash(p)
+	dir, base := path.Dir(p), path.Base(p)
+	ext := path.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+
+	switch language {
+	case "go":
+		if ext != ".go" || strings.HasSuffix(name, "_test") || name == "main" {
+			return "", false
+		}
+		return path.Join(dir, name+"_test.go"), true
+
+	case "python":
+		if ext != ".py" || strings.HasPrefix(name, "test_") || strings.HasSuffix(name, "_test") ||
+			name == "__init__" || name == "setup" || name == "conftest" || isUnder(dir, "tests") {
+			return "", false
+		}
+		return path.Join("tests", "test_"+name+".py"), true
+
+	case "javascript":
+		if (ext != ".js" && ext != ".mjs" && ext != ".ts") || strings.HasSuffix(name, ".test") ||
+			strings.HasSuffix(name, ".spec") || strings.HasSuffix(name, ".config") || hasSegment(dir, "__tests__") {
+			return "", false
+		}
+		return path.Join(dir, name+".test"+ext), true
+
+	case "java":
+		if ext != ".java" || strings.HasSuffix(name, "Test") || isUnder(dir, "src/test") {
+			return "", false
+		}
+		if rest, ok := strings.CutPrefix(dir, "src/main/java"); ok {
+			return path.Join("src/test/java", rest, name+"Test.java"), true
+		}
+		return path.Join(dir, name+"Test.java"), true
+	}
+
+	return "", false
+}
+
+func isUnder(dir, root string) bool {
+	return dir == root || strings.HasPrefix(dir, root+"/")
+}
+
+// hasSegment reports whether dir contains a directory named name at any depth.
+func hasSegment(dir, name string) bool {
+	return strings.Contains("/"+dir+"/", "/"+name+"/")
+}
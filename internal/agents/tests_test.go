@@ -0,0 +1,44 @@
+package agents
+
+import "testing"
+
+func TestTestPathFor(t *testing.T) {
+	tests := []struct {
+		language string
+		path     string
+		want     string
+		ok       bool
+	}{
+		{"go", "store/store.go", "store/store_test.go", true},
+		{"go", "store/store_test.go", "", false},
+		{"go", "main.go", "", false},
+		{"go", "go.mod", "", false},
+
+		{"python", "app/models.py", "tests/test_models.py", true},
+		{"python", "app/__init__.py", "", false},
+		{"python", "tests/helpers.py", "", false},
+		{"python", "test_models.py", "", false},
+		{"python", "conftest.py", "", false},
+
+		{"javascript", "src/routes/users.js", "src/routes/users.test.js", true},
+		{"javascript", "src/index.ts", "src/index.test.ts", true},
+		{"javascript", "src/users.test.js", "", false},
+		{"javascript", "jest.config.js", "", false},
+		{"javascript", "src/__tests__/users.js", "", false},
+		{"javascript", "package.json", "", false},
+
+		{"java", "src/main/java/com/acme/Order.java", "src/test/java/com/acme/OrderTest.java", true},
+		{"java", "Order.java", "OrderTest.java", true},
+		{"java", "src/test/java/com/acme/Helper.java", "", false},
+		{"java", "src/main/java/com/acme/OrderTest.java", "", false},
+
+		{"rust", "src/main.rs", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := testPathFor(tt.language, tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("testPathFor(%q, %q) = %q, %v, want %q, %v", tt.language, tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
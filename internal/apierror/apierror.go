@@ -0,0 +1,56 @@
+// Package apierror defines the error responses of the HTTP API: a status
+// code, a stable machine-readable code, a message for people and the ID of
+// the request that failed.
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/requestid"
+)
+
+// Codes of error responses. Clients branch on these rather than on messages,
+// so they don't change once published.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeFailedValidation = "failed_validation"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeEditConflict     = "edit_conflict"
+	CodeRateLimited      = "rate_limited"
+	CodeBlocked          = "blocked"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal"
+)
+
+// Body returns the envelope of an error response to r. message is a string,
+// or a map of field names to problems for CodeFailedValidation.
+//
+//	{"error": "the requested resource could not be found", "code": "not_found", "request_id": "…"}
+func Body(r *http.Request, code string, message any) map[string]any {
+	body := map[string]any{
+		"error": message,
+		"code":  code,
+	}
+	if id := requestid.ContextGet(r); id != "" {
+		body["request_id"] = id
+	}
+	return body
+}
+
+// Write sends an error response with the given status.
+func Write(w http.ResponseWriter, r *http.Request, status int, code string, message any) {
+	WriteBody(w, status, Body(r, code, message))
+}
+
+// WriteBody sends an envelope returned by Body, possibly with fields added,
+// with the given status.
+func WriteBody(w http.ResponseWriter, status int, body map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
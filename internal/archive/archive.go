@@ -0,0 +1,198 @@
+// Package archive streams generated projects as zip, tar.gz or tar.zst
+// archives.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported archive formats.
+const (
+	FormatZip    = "zip"
+	FormatTarGz  = "tar.gz"
+	FormatTarZst = "tar.zst"
+)
+
+var contentTypes = map[string]string{
+	FormatZip:    "application/zip",
+	FormatTarGz:  "application/gzip",
+	FormatTarZst: "application/zstd",
+}
+
+// ParseFormat validates an archive format, defaulting to zip. "tgz" and
+// "tzst" are accepted as aliases.
+func ParseFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", FormatZip:
+		return FormatZip, nil
+	case FormatTarGz, "tgz":
+		return FormatTarGz, nil
+	case FormatTarZst, "tzst":
+		return FormatTarZst, nil
+	}
+	return "", fmt.Errorf("unknown archive format %q (expected zip, tar.gz or tar.zst)", format)
+}
+
+// Extension returns the file name extension of a format, including the dot.
+func Extension(format string) string {
+	return "." + format
+}
+
+// ContentType returns the MIME type of a format.
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// List returns the slash-separated paths of the regular files under dir,
+// sorted.
+func List(dir string) ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+
+	sort.Strings(files)
+	return files, err
+}
+
+// Write streams the given files of fsys to w in the requested format.
+// Nothing is buffered on disk.
+func Write(w io.Writer, format string, fsys fs.FS, files []string) error {
+	switch format {
+	case FormatZip:
+		return writeZip(w, fsys, files)
+	case FormatTarGz:
+		gz := gzip.NewWriter(w)
+		if err := writeTar(gz, fsys, files); err != nil {
+			gz.Close()
+			return err
+		}
+		return gz.Close()
+	case FormatTarZst:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		if err := writeTar(zw, fsys, files); err != nil {
+			zw.Close()
+			return err
+		}
+		return zw.Close()
+	}
+
+	return fmt.Errorf("unknown archive format %q", format)
+}
+
+// WriteFile writes an archive of every file under dir to path.
+func WriteFile(path, format, dir string) error {
+	files, err := List(dir)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := Write(f, format, os.DirFS(dir), files); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeZip(w io.Writer, fsys fs.FS, files []string) error {
+	archive := zip.NewWriter(w)
+
+	for _, name := range files {
+		err := copyFile(fsys, name, func(info fs.FileInfo) (io.Writer, error) {
+			header, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return nil, err
+			}
+			header.Name = name
+			header.Method = zip.Deflate
+			return archive.CreateHeader(header)
+		})
+		if err != nil {
+			archive.Close()
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeTar(w io.Writer, fsys fs.FS, files []string) error {
+	archive := tar.NewWriter(w)
+
+	for _, name := range files {
+		err := copyFile(fsys, name, func(info fs.FileInfo) (io.Writer, error) {
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return nil, err
+			}
+			header.Name = name
+			// Files may be owned by the sandbox user; don't leak local ids.
+			header.Uid, header.Gid = 0, 0
+			header.Uname, header.Gname = "", ""
+			if err := archive.WriteHeader(header); err != nil {
+				return nil, err
+			}
+			return archive, nil
+		})
+		if err != nil {
+			archive.Close()
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// copyFile opens a file and copies it into the entry created by create.
+func copyFile(fsys fs.FS, name string, create func(fs.FileInfo) (io.Writer, error)) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	entry, err := create(info)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, file)
+	return err
+}
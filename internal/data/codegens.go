@@ -2,8 +2,13 @@ package data
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 type CodenGen struct {
@@ -16,8 +21,32 @@ type CodenGen struct {
 	Model       string `json:"model"`
 	ProjectName string `json:"projectName"`
 	Prompt      string `json:"prompt"`
+	SessionID   string `json:"sessionId"`
+	Status      string `json:"status"`
+	// TestsPassed is nil until the project's build and test commands ran.
+	TestsPassed *bool  `json:"testsPassed,omitempty"`
+	TestOutput  string `json:"testOutput,omitempty"`
+	Protocol    string `json:"protocol"`
+	// Sampling is the JSON encoded sampling parameters of the generation.
+	Sampling json.RawMessage `json:"sampling,omitempty"`
+	// CreatedAt is zero for generations recorded before creation times
+	// were.
+	CreatedAt time.Time `json:"createdAt"`
 }
 
+const (
+	StatusRunning  = "running"
+	StatusComplete = "complete"
+	StatusFailed   = "failed"
+	StatusBlocked  = "blocked"
+	// StatusExpired marks generations whose output the janitor deleted.
+	StatusExpired = "expired"
+	// StatusInterrupted marks generations cut short by a server shutdown.
+	StatusInterrupted = "interrupted"
+	// StatusCancelled marks generations the client cancelled.
+	StatusCancelled = "cancelled"
+)
+
 type CodeGenModel struct {
 	DB *sql.DB
 }
@@ -25,10 +54,20 @@ type CodeGenModel struct {
 // Create inserts a new CodenGen record into the database
 func (m *CodeGenModel) Create(cg *CodenGen) error {
 	query := `
-		INSERT INTO codegen (user_id, language, template, basepackage, workers, model, projectname, prompt)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO codegen (user_id, language, template, basepackage, workers, model, projectname, prompt, session_id, status, protocol, sampling)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id`
 
+	if cg.Status == "" {
+		cg.Status = StatusRunning
+	}
+	if cg.Protocol == "" {
+		cg.Protocol = "delimited"
+	}
+	if len(cg.Sampling) == 0 {
+		cg.Sampling = json.RawMessage("{}")
+	}
+
 	err := m.DB.QueryRow(query,
 		cg.UserID,
 		cg.Language,
@@ -38,6 +77,10 @@ func (m *CodeGenModel) Create(cg *CodenGen) error {
 		cg.Model,
 		cg.ProjectName,
 		cg.Prompt,
+		cg.SessionID,
+		cg.Status,
+		cg.Protocol,
+		string(cg.Sampling),
 	).Scan(&cg.ID)
 
 	if err != nil {
@@ -47,11 +90,43 @@ func (m *CodeGenModel) Create(cg *CodenGen) error {
 	return nil
 }
 
+// UpdateStatus records the status, test outcome, response protocol and
+// sampling parameters of a CodenGen record.
+func (m *CodeGenModel) UpdateStatus(cg *CodenGen) error {
+	query := `
+		UPDATE codegen
+		SET status = $1, tests_passed = $2, test_output = $3, protocol = $4, sampling = COALESCE($5, sampling)
+		WHERE id = $6`
+
+	var sampling *string
+	if len(cg.Sampling) > 0 {
+		s := string(cg.Sampling)
+		sampling = &s
+	}
+
+	result, err := m.DB.Exec(query, cg.Status, cg.TestsPassed, cg.TestOutput, cg.Protocol, sampling, cg.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update codegen record %d: %w", cg.ID, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update codegen record %d: %w", cg.ID, err)
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
 // GetAll retrieves all CodenGen records from the database
 
 func (m *CodeGenModel) GetAllByUserID(userID int) ([]*CodenGen, error) {
 	query := `
-		SELECT id, user_id, language, template, basepackage, workers, model, projectname, prompt
+		SELECT id, user_id, language, template, basepackage, workers, model, projectname, prompt,
+			session_id, status, tests_passed, test_output, protocol, sampling, created_at
 		FROM codegen
 		WHERE user_id = $1
 		ORDER BY id`
@@ -66,6 +141,7 @@ func (m *CodeGenModel) GetAllByUserID(userID int) ([]*CodenGen, error) {
 
 	for rows.Next() {
 		cg := &CodenGen{}
+		var createdAt sql.NullTime
 		err := rows.Scan(
 			&cg.ID,
 			&cg.UserID,
@@ -76,10 +152,18 @@ func (m *CodeGenModel) GetAllByUserID(userID int) ([]*CodenGen, error) {
 			&cg.Model,
 			&cg.ProjectName,
 			&cg.Prompt,
+			&cg.SessionID,
+			&cg.Status,
+			&cg.TestsPassed,
+			&cg.TestOutput,
+			&cg.Protocol,
+			&cg.Sampling,
+			&createdAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan codegen record: %w", err)
 		}
+		cg.CreatedAt = createdAt.Time
 		codegens = append(codegens, cg)
 	}
 
@@ -90,6 +174,147 @@ func (m *CodeGenModel) GetAllByUserID(userID int) ([]*CodenGen, error) {
 	return codegens, nil
 }
 
+// GetBySessionID returns the generation that wrote a session's output.
+func (m *CodeGenModel) GetBySessionID(sessionID string) (*CodenGen, error) {
+	query := `
+		SELECT id, user_id, language, template, basepackage, workers, model, projectname, prompt,
+			session_id, status, tests_passed, test_output, protocol, sampling, created_at
+		FROM codegen
+		WHERE session_id = $1`
+
+	cg := &CodenGen{}
+	var createdAt sql.NullTime
+	err := m.DB.QueryRow(query, sessionID).Scan(
+		&cg.ID,
+		&cg.UserID,
+		&cg.Language,
+		&cg.Template,
+		&cg.BasePackage,
+		&cg.Workers,
+		&cg.Model,
+		&cg.ProjectName,
+		&cg.Prompt,
+		&cg.SessionID,
+		&cg.Status,
+		&cg.TestsPassed,
+		&cg.TestOutput,
+		&cg.Protocol,
+		&cg.Sampling,
+		&createdAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to get codegen record for session %s: %w", sessionID, err)
+	}
+	cg.CreatedAt = createdAt.Time
+
+	return cg, nil
+}
+
+// Session is the output directory of a generation, as seen by the janitor.
+// CreatedAt is zero when the creation time is unknown.
+type Session struct {
+	SessionID string
+	UserID    int
+	Status    string
+	CreatedAt time.Time
+}
+
+// ListSessions returns every generation whose output hasn't expired yet.
+func (m *CodeGenModel) ListSessions() ([]Session, error) {
+	query := `
+		SELECT session_id, user_id, status, created_at
+		FROM codegen
+		WHERE session_id <> '' AND status <> $1
+		ORDER BY created_at`
+
+	rows, err := m.DB.Query(query, StatusExpired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var s Session
+		var createdAt sql.NullTime
+		if err := rows.Scan(&s.SessionID, &s.UserID, &s.Status, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		s.CreatedAt = createdAt.Time
+		sessions = append(sessions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred during row iteration: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// MarkExpired sets the status of the given sessions' generations to expired
+// and drops their progress events. Both happen in one transaction, so
+// sessions are only expired, and no longer listed, once their events are
+// gone.
+func (m *CodeGenModel) MarkExpired(sessionIDs []string) (int64, error) {
+	if len(sessionIDs) == 0 {
+		return 0, nil
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin expiring sessions: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE codegen
+		SET status = $1
+		WHERE session_id = ANY($2)`
+
+	result, err := tx.Exec(query, StatusExpired, pq.Array(sessionIDs))
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark sessions expired: %w", err)
+	}
+
+	expired, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM codegen_events WHERE session_id = ANY($1)`, pq.Array(sessionIDs)); err != nil {
+		return 0, fmt.Errorf("failed to delete events of expired sessions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit expired sessions: %w", err)
+	}
+
+	return expired, nil
+}
+
+// MarkInterrupted sets the status of the given sessions' generations to
+// interrupted, unless they finished in the meantime.
+func (m *CodeGenModel) MarkInterrupted(sessionIDs []string) (int64, error) {
+	if len(sessionIDs) == 0 {
+		return 0, nil
+	}
+
+	query := `
+		UPDATE codegen
+		SET status = $1
+		WHERE session_id = ANY($2) AND status = $3`
+
+	result, err := m.DB.Exec(query, StatusInterrupted, pq.Array(sessionIDs), StatusRunning)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark sessions interrupted: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
 // Helper function to convert string UserID to int
 func (m *CodeGenModel) CreateWithStringUserID(cg *CodenGen, userIDStr string) error {
 	if userIDStr == "" {
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Event is a progress event of a generation, kept so clients that lose
+// their connection can replay what they missed.
+type Event struct {
+	SessionID string
+	Seq       int64
+	Type      string
+	// Payload is the JSON encoded event.
+	Payload json.RawMessage
+}
+
+// AppendEvent stores an event of a session. Sequence numbers are assigned by
+// the caller and must grow within a session.
+func (m *CodeGenModel) AppendEvent(e *Event) error {
+	query := `
+		INSERT INTO codegen_events (session_id, seq, type, payload)
+		VALUES ($1, $2, $3, $4)`
+
+	if _, err := m.DB.Exec(query, e.SessionID, e.Seq, e.Type, []byte(e.Payload)); err != nil {
+		return fmt.Errorf("failed to store event %d of session %s: %w", e.Seq, e.SessionID, err)
+	}
+
+	return nil
+}
+
+// EventsAfter returns the events of a session with a sequence number above
+// after, oldest first.
+func (m *CodeGenModel) EventsAfter(sessionID string, after int64) ([]Event, error) {
+	query := `
+		SELECT session_id, seq, type, payload
+		FROM codegen_events
+		WHERE session_id = $1 AND seq > $2
+		ORDER BY seq`
+
+	rows, err := m.DB.Query(query, sessionID, after)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events of session %s: %w", sessionID, err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.SessionID, &e.Seq, &e.Type, &e.Payload); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred during row iteration: %w", err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,372 @@
+// Package guard looks for secrets, prompt injection and dangerous commands
+// in the text that goes into and comes out of the model.
+package guard
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Severities of findings. High severity findings can block a download.
+const (
+	SeverityHigh   = "high"
+	SeverityMedium = "medium"
+	SeverityLow    = "low"
+)
+
+// Finding is a single match of a rule.
+type Finding struct {
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	// Match is the matched text, redacted for secrets.
+	Match string `json:"match"`
+}
+
+type rule struct {
+	name     string
+	severity string
+	message  string
+	pattern  *regexp.Regexp
+	// group selects the submatch holding the secret; 0 is the whole match.
+	group int
+	// secret rules are redacted, both in prompts and in reported matches.
+	secret bool
+}
+
+var secretRules = []rule{
+	{
+		name:     "private-key",
+		severity: SeverityHigh,
+		message:  "private key",
+		pattern:  regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )*PRIVATE KEY-----[\s\S]*?-----END (?:[A-Z]+ )*PRIVATE KEY-----`),
+		secret:   true,
+	},
+	{
+		name:     "openai-key",
+		severity: SeverityHigh,
+		message:  "OpenAI API key",
+		pattern:  regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9_-]{20,}`),
+		secret:   true,
+	},
+	{
+		name:     "aws-access-key",
+		severity: SeverityHigh,
+		message:  "AWS access key ID",
+		pattern:  regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+		secret:   true,
+	},
+	{
+		name:     "github-token",
+		severity: SeverityHigh,
+		message:  "GitHub token",
+		pattern:  regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{40,})\b`),
+		secret:   true,
+	},
+	{
+		name:     "slack-token",
+		severity: SeverityHigh,
+		message:  "Slack token",
+		pattern:  regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+		secret:   true,
+	},
+	{
+		name:     "google-api-key",
+		severity: SeverityHigh,
+		message:  "Google API key",
+		pattern:  regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+		secret:   true,
+	},
+	{
+		name:     "stripe-key",
+		severity: SeverityHigh,
+		message:  "Stripe secret key",
+		pattern:  regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{20,}\b`),
+		secret:   true,
+	},
+	{
+		name:     "jwt",
+		severity: SeverityMedium,
+		message:  "JSON web token",
+		pattern:  regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`),
+		secret:   true,
+	},
+	{
+		name:     "password-assignment",
+		severity: SeverityMedium,
+		message:  "hard-coded password or secret",
+		pattern:  regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|api[_-]?key|access[_-]?token|auth[_-]?token)\b["']?\s*[:=]\s*["']([^"'\s]{6,})["']`),
+		group:    1,
+		secret:   true,
+	},
+	{
+		name:     "url-credentials",
+		severity: SeverityMedium,
+		message:  "credentials embedded in a URL",
+		pattern:  regexp.MustCompile(`\b[a-z][a-z0-9+.-]*://[^/\s:@"']+:([^/\s:@"']{3,})@`),
+		group:    1,
+		secret:   true,
+	},
+}
+
+var dangerousRules = []rule{
+	{
+		name:     "pipe-to-shell",
+		severity: SeverityHigh,
+		message:  "downloads a script and pipes it into a shell",
+		pattern:  regexp.MustCompile(`\b(?:curl|wget)\b[^\n|]*\|\s*(?:sudo\s+)?(?:ba|z|da)?sh\b`),
+	},
+	{
+		name:     "eval-download",
+		severity: SeverityHigh,
+		message:  "evaluates downloaded code",
+		pattern:  regexp.MustCompile(`\beval\s+["']?\$\((?:curl|wget)\b`),
+	},
+	{
+		name:     "decode-to-shell",
+		severity: SeverityHigh,
+		message:  "decodes data and pipes it into a shell",
+		pattern:  regexp.MustCompile(`base64\s+(?:-d|--decode)\b[^\n|]*\|\s*(?:ba)?sh\b`),
+	},
+	{
+		name:     "rm-root",
+		severity: SeverityHigh,
+		message:  "recursively deletes the filesystem root or home directory",
+		pattern:  regexp.MustCompile(`\brm\s+-[a-zA-Z]*[rR][a-zA-Z]*\s+(?:--no-preserve-root\s+)?(?:/|~|\$HOME)(?:\s|$|\*)`),
+	},
+	{
+		name:     "world-writable",
+		severity: SeverityMedium,
+		message:  "makes files world-writable",
+		pattern:  regexp.MustCompile(`\bchmod\s+(?:-R\s+)?0?777\b`),
+	},
+}
+
+var injectionRules = []rule{
+	{
+		name:     "ignore-instructions",
+		severity: SeverityMedium,
+		message:  "asks the model to ignore its instructions",
+		pattern:  regexp.MustCompile(`(?i)\b(?:ignore|disregard|forget)\b[^.\n]{0,30}\b(?:previous|prior|above|earlier|system|all)\b[^.\n]{0,20}\b(?:instructions|prompts?|rules)\b`),
+	},
+	{
+		name:     "reveal-prompt",
+		severity: SeverityMedium,
+		message:  "asks the model to reveal its system prompt",
+		pattern:  regexp.MustCompile(`(?i)\b(?:reveal|print|show|repeat|output)\b[^.\n]{0,30}\bsystem prompt\b`),
+	},
+	{
+		name:     "role-override",
+		severity: SeverityLow,
+		message:  "tries to change the model's role",
+		pattern:  regexp.MustCompile(`(?i)\byou are (?:now|no longer)\b|\bnew (?:system )?instructions:`),
+	},
+}
+
+// placeholderWords are the words placeholder values are made of.
+const placeholderWords = `changeme|change_me|replaceme|replace_me|example|sample|dummy|fake|test|placeholder|secret|password|token|key|here`
+
+// placeholderRegex matches values that are obviously not real secrets. It
+// must match the whole value, so real secrets that merely contain such a
+// word are still reported: templates such as <token>, ${VAR} or {{ var }},
+// names like your_api_key_here, placeholder words joined by - or _, runs
+// of x or * after an optional prefix, and the documentation's EXAMPLE keys.
+var placeholderRegex = regexp.MustCompile(`(?i)^(?:` +
+	`<[^<>]*>|\$\{[^{}]*\}|\{\{[^{}]*\}\}|%[^%]*%|` +
+	`(?:your|my)[a-z_-]*|` +
+	`(?:` + placeholderWords + `)(?:[_-](?:` + placeholderWords + `))*|` +
+	`(?:[a-z]+[_-]?)*(?:x{4,}|\*{3,})|` +
+	`[a-z0-9]*example` +
+	`)$`)
+
+// RedactPrompt replaces secrets in a prompt with placeholders before it is
+// sent to the model, and flags attempts at prompt injection. Every rule
+// scans the prompt as given, so line numbers refer to it.
+func RedactPrompt(prompt string) (string, []Finding) {
+	var secrets []hit
+	for _, r := range secretRules {
+		secrets = append(secrets, r.scan("", prompt)...)
+	}
+	spans := mergeSpans(secrets)
+
+	hits := secrets
+	for _, r := range injectionRules {
+		for _, h := range r.scan("", prompt) {
+			// Injection matches are reported verbatim, minus any secret
+			// they contain.
+			h.Match = redactSpans(prompt, spans, h.start, h.end)
+			hits = append(hits, h)
+		}
+	}
+
+	return redactSpans(prompt, spans, 0, len(prompt)), findings(hits)
+}
+
+// ScanFile looks for hard-coded credentials and dangerous commands in a
+// generated file.
+func ScanFile(path, content string) []Finding {
+	var hits []hit
+
+	for _, r := range secretRules {
+		hits = append(hits, r.scan(path, content)...)
+	}
+	for _, r := range dangerousRules {
+		hits = append(hits, r.scan(path, content)...)
+	}
+
+	return findings(hits)
+}
+
+// ScanFiles scans every file, in path order.
+func ScanFiles(files map[string]string) []Finding {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var findings []Finding
+	for _, p := range paths {
+		findings = append(findings, ScanFile(p, files[p])...)
+	}
+	return findings
+}
+
+// Blocking reports whether any finding is severe enough to withhold the
+// generated project.
+func Blocking(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity == SeverityHigh {
+			return true
+		}
+	}
+	return false
+}
+
+// hit is a finding together with the offsets of the matched text.
+type hit struct {
+	Finding
+	start, end int
+}
+
+func (r rule) scan(path, content string) []hit {
+	var hits []hit
+
+	for _, loc := range r.pattern.FindAllStringSubmatchIndex(content, -1) {
+		start, end := loc[2*r.group], loc[2*r.group+1]
+		if start < 0 {
+			continue
+		}
+
+		match := content[start:end]
+		if r.secret && placeholderRegex.MatchString(match) {
+			continue
+		}
+
+		if r.secret {
+			match = mask(match)
+		} else {
+			match = content[loc[0]:loc[1]]
+		}
+
+		hits = append(hits, hit{
+			Finding: Finding{
+				File:     path,
+				Line:     strings.Count(content[:loc[0]], "\n") + 1,
+				Rule:     r.name,
+				Severity: r.severity,
+				Message:  r.message,
+				Match:    match,
+			},
+			start: start,
+			end:   end,
+		})
+	}
+
+	return hits
+}
+
+// mergeSpans orders secrets by offset and joins overlapping ones, keeping
+// the rule that matched first.
+func mergeSpans(secrets []hit) []hit {
+	spans := slices.Clone(secrets)
+	slices.SortStableFunc(spans, func(a, b hit) int {
+		return a.start - b.start
+	})
+
+	merged := spans[:0]
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s.start < merged[n-1].end {
+			merged[n-1].end = max(merged[n-1].end, s.end)
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// redactSpans returns content[from:to] with the secrets at spans, as
+// returned by mergeSpans, replaced by placeholders.
+func redactSpans(content string, spans []hit, from, to int) string {
+	var b strings.Builder
+	last := from
+
+	for _, s := range spans {
+		if s.end <= last || s.start >= to {
+			continue
+		}
+
+		b.WriteString(content[last:max(s.start, last)])
+		b.WriteString("[REDACTED " + strings.ToUpper(strings.ReplaceAll(s.Rule, "-", "_")) + "]")
+		last = s.end
+	}
+
+	if last < to {
+		b.WriteString(content[last:to])
+	}
+	return b.String()
+}
+
+// mask keeps just enough of a secret to recognise it.
+func mask(secret string) string {
+	if i := strings.IndexByte(secret, '\n'); i >= 0 {
+		return secret[:i] + "..."
+	}
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + strings.Repeat("*", len(secret)-4)
+}
+
+// findings sorts hits by file and line and drops hits of later rules for
+// text an earlier rule already reported, such as a key that is also a
+// password assignment.
+func findings(hits []hit) []Finding {
+	slices.SortStableFunc(hits, func(a, b hit) int {
+		if c := strings.Compare(a.File, b.File); c != 0 {
+			return c
+		}
+		return a.Line - b.Line
+	})
+
+	type key struct {
+		file       string
+		start, end int
+	}
+
+	seen := make(map[key]bool, len(hits))
+	var out []Finding
+	for _, h := range hits {
+		k := key{h.File, h.start, h.end}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, h.Finding)
+	}
+	return out
+}
@@ -0,0 +1,376 @@
+// Package janitor deletes old sessions from the artifact store so generated
+// projects don't fill the disk.
+package janitor
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/data"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/storage"
+)
+
+// Reasons a session is expired.
+const (
+	ReasonAge        = "age"
+	ReasonUserLimit  = "user-limit"
+	ReasonDiskBudget = "disk-budget"
+)
+
+// orphanGrace is how long a session without a database record is left
+// alone, so generations that are just starting aren't swept.
+const orphanGrace = time.Hour
+
+// Policy is the retention policy. Zero values disable a limit.
+type Policy struct {
+	// MaxAge is how long sessions are kept.
+	MaxAge time.Duration
+	// MaxSessionsPerUser is how many sessions each user keeps; older ones
+	// are deleted first.
+	MaxSessionsPerUser int
+	// MaxTotalBytes is the storage budget of all sessions; the oldest
+	// sessions are deleted until they fit.
+	MaxTotalBytes int64
+}
+
+// Expired is a session the janitor deleted, or would delete on a dry run.
+type Expired struct {
+	SessionID string    `json:"sessionId"`
+	UserID    int       `json:"userId,omitempty"`
+	Reason    string    `json:"reason"`
+	Bytes     int64     `json:"bytes"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Report summarises a sweep.
+type Report struct {
+	DryRun     bool      `json:"dryRun"`
+	StartedAt  time.Time `json:"startedAt"`
+	Sessions   int       `json:"sessions"`
+	TotalBytes int64     `json:"totalBytes"`
+	FreedBytes int64     `json:"freedBytes"`
+	Expired    []Expired `json:"expired"`
+	// WorkDirs are the local working directories left behind by crashed
+	// generations that were removed.
+	WorkDirs []string `json:"workDirs,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// Janitor applies a retention policy to the sessions in an artifact store.
+type Janitor struct {
+	store    storage.ArtifactStore
+	policy   Policy
+	codegens *data.CodeGenModel
+
+	// workDir holds the local working directories of generations when
+	// the store is remote; running reports those still in use.
+	workDir string
+	running func(sessionID string) bool
+
+	// mu serialises sweeps so a dry run never races a real one.
+	mu sync.Mutex
+}
+
+// New returns a janitor for the sessions kept in store.
+func New(store storage.ArtifactStore, policy Policy, codegens *data.CodeGenModel) *Janitor {
+	return &Janitor{
+		store:    store,
+		policy:   policy,
+		codegens: codegens,
+	}
+}
+
+// SetWorkDir makes sweeps also remove the working directories in dir that
+// generations left behind when the server stopped mid-run. Only use it
+// with a remote store, where dir holds nothing else; running reports the
+// sessions being generated.
+func (j *Janitor) SetWorkDir(dir string, running func(sessionID string) bool) {
+	j.workDir = dir
+	j.running = running
+}
+
+// Policy returns the retention policy in use.
+func (j *Janitor) Policy() Policy {
+	return j.policy
+}
+
+type session struct {
+	id        string
+	userID    int
+	status    string
+	createdAt time.Time
+	bytes     int64
+	// orphan is set for sessions without a database record.
+	orphan bool
+	// datedByFiles is set for sessions whose creation time is unknown.
+	datedByFiles bool
+}
+
+// Run sweeps the output directory every interval until ctx is done.
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := j.Sweep(ctx, false)
+		if err != nil {
+			log.Printf("Janitor sweep failed: %v", err)
+		} else if len(report.Expired) > 0 || len(report.WorkDirs) > 0 || len(report.Errors) > 0 {
+			log.Printf("Janitor expired %d of %d sessions and removed %d working directories, freeing %d bytes (%d errors)",
+				len(report.Expired), report.Sessions, len(report.WorkDirs), report.FreedBytes, len(report.Errors))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes the sessions the policy expires and marks them expired in
+// the database. With dryRun set it only reports what it would delete.
+func (j *Janitor) Sweep(ctx context.Context, dryRun bool) (*Report, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	report := &Report{DryRun: dryRun, StartedAt: time.Now().UTC()}
+
+	sessions, err := j.scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Sessions = len(sessions)
+	for _, s := range sessions {
+		report.TotalBytes += s.bytes
+	}
+
+	for _, e := range j.plan(sessions, report.StartedAt) {
+		if !dryRun {
+			if err := j.store.Delete(ctx, e.SessionID+"/"); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", e.SessionID, err))
+				continue
+			}
+		}
+		report.FreedBytes += e.Bytes
+		report.Expired = append(report.Expired, e)
+	}
+
+	if j.workDir != "" {
+		j.sweepWorkDirs(report, dryRun)
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	ids := make([]string, 0, len(report.Expired))
+	for _, e := range report.Expired {
+		ids = append(ids, e.SessionID)
+	}
+	if _, err := j.codegens.MarkExpired(ids); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	return report, nil
+}
+
+// scan joins the sessions in the store with their database records.
+func (j *Janitor) scan(ctx context.Context) ([]*session, error) {
+	objects, err := j.store.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("listing artifacts: %w", err)
+	}
+
+	records, err := j.codegens.ListSessions()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]data.Session, len(records))
+	for _, r := range records {
+		byID[r.SessionID] = r
+	}
+
+	byKey := make(map[string]*session)
+	var sessions []*session
+	for _, obj := range objects {
+		id, _, ok := strings.Cut(obj.Key, "/")
+		if !ok || strings.HasPrefix(id, ".") {
+			continue
+		}
+
+		s, ok := byKey[id]
+		if !ok {
+			s = &session{id: id, orphan: true, datedByFiles: true}
+			if r, found := byID[id]; found {
+				s.userID = r.UserID
+				s.status = r.Status
+				s.createdAt = r.CreatedAt
+				s.orphan = false
+				s.datedByFiles = r.CreatedAt.IsZero()
+			}
+			byKey[id] = s
+			sessions = append(sessions, s)
+		}
+
+		s.bytes += obj.Size
+		// Sessions of unknown age are as old as their most recently
+		// written file.
+		if s.datedByFiles && obj.ModTime.After(s.createdAt) {
+			s.createdAt = obj.ModTime
+		}
+	}
+
+	sort.Slice(sessions, func(a, b int) bool {
+		return sessions[a].createdAt.Before(sessions[b].createdAt)
+	})
+
+	return sessions, nil
+}
+
+// plan picks the sessions to expire, oldest first. Running generations are
+// only expired by age, and orphans only after orphanGrace.
+func (j *Janitor) plan(sessions []*session, now time.Time) []Expired {
+	expired := make(map[string]string)
+
+	eligible := func(s *session) bool {
+		if _, done := expired[s.id]; done {
+			return false
+		}
+		if s.orphan && now.Sub(s.createdAt) < orphanGrace {
+			return false
+		}
+		return true
+	}
+
+	if j.policy.MaxAge > 0 {
+		for _, s := range sessions {
+			if eligible(s) && now.Sub(s.createdAt) > j.policy.MaxAge {
+				expired[s.id] = ReasonAge
+			}
+		}
+	}
+
+	if j.policy.MaxSessionsPerUser > 0 {
+		kept := make(map[int]int)
+		for i := len(sessions) - 1; i >= 0; i-- {
+			s := sessions[i]
+			if s.orphan || !eligible(s) {
+				continue
+			}
+			kept[s.userID]++
+			if kept[s.userID] > j.policy.MaxSessionsPerUser && s.status != data.StatusRunning {
+				expired[s.id] = ReasonUserLimit
+			}
+		}
+	}
+
+	if j.policy.MaxTotalBytes > 0 {
+		var total int64
+		for _, s := range sessions {
+			if _, done := expired[s.id]; !done {
+				total += s.bytes
+			}
+		}
+		for _, s := range sessions {
+			if total <= j.policy.MaxTotalBytes {
+				break
+			}
+			if eligible(s) && s.status != data.StatusRunning {
+				expired[s.id] = ReasonDiskBudget
+				total -= s.bytes
+			}
+		}
+	}
+
+	var list []Expired
+	for _, s := range sessions {
+		reason, ok := expired[s.id]
+		if !ok {
+			continue
+		}
+		list = append(list, Expired{
+			SessionID: s.id,
+			UserID:    s.userID,
+			Reason:    reason,
+			Bytes:     s.bytes,
+			CreatedAt: s.createdAt,
+		})
+	}
+
+	return list
+}
+
+// sweepWorkDirs removes the working directories of generations that are no
+// longer running on this server and weren't written to for orphanGrace.
+func (j *Janitor) sweepWorkDirs(report *Report, dryRun bool) {
+	entries, err := os.ReadDir(j.workDir)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("listing working directories: %v", err))
+		return
+	}
+
+	for _, e := range entries {
+		id := e.Name()
+		if !e.IsDir() || strings.HasPrefix(id, ".") || j.running(id) {
+			continue
+		}
+
+		dir := filepath.Join(j.workDir, id)
+		bytes, modTime, err := dirUsage(dir)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", dir, err))
+			continue
+		}
+		if report.StartedAt.Sub(modTime) < orphanGrace {
+			continue
+		}
+
+		if !dryRun {
+			if err := os.RemoveAll(dir); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", dir, err))
+				continue
+			}
+		}
+		report.FreedBytes += bytes
+		report.WorkDirs = append(report.WorkDirs, id)
+	}
+}
+
+// dirUsage returns the size of the files below dir and the time anything
+// in it was last modified.
+func dirUsage(dir string) (int64, time.Time, error) {
+	var (
+		bytes   int64
+		modTime time.Time
+	)
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			bytes += info.Size()
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+		return nil
+	})
+
+	return bytes, modTime, err
+}
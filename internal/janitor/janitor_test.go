@@ -0,0 +1,136 @@
+package janitor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/data"
+)
+
+func TestPlan(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		sessions []*session
+		want     map[string]string
+	}{
+		{
+			name:   "age",
+			policy: Policy{MaxAge: 24 * time.Hour},
+			sessions: []*session{
+				{id: "old", userID: 1, status: data.StatusComplete, createdAt: ago(48 * time.Hour)},
+				{id: "old-running", userID: 1, status: data.StatusRunning, createdAt: ago(47 * time.Hour)},
+				{id: "old-orphan", orphan: true, createdAt: ago(46 * time.Hour)},
+				{id: "new-orphan", orphan: true, createdAt: ago(30 * time.Minute)},
+				{id: "new", userID: 1, status: data.StatusComplete, createdAt: ago(time.Hour)},
+			},
+			want: map[string]string{"old": ReasonAge, "old-running": ReasonAge, "old-orphan": ReasonAge},
+		},
+		{
+			name:   "sessions per user",
+			policy: Policy{MaxSessionsPerUser: 1},
+			sessions: []*session{
+				{id: "u1-old", userID: 1, status: data.StatusComplete, createdAt: ago(3 * time.Hour)},
+				{id: "u1-running", userID: 1, status: data.StatusRunning, createdAt: ago(2 * time.Hour)},
+				{id: "u2-old", userID: 2, status: data.StatusFailed, createdAt: ago(2 * time.Hour)},
+				{id: "orphan", orphan: true, createdAt: ago(2 * time.Hour)},
+				{id: "u1-new", userID: 1, status: data.StatusComplete, createdAt: ago(time.Hour)},
+			},
+			want: map[string]string{"u1-old": ReasonUserLimit},
+		},
+		{
+			name:   "disk budget",
+			policy: Policy{MaxTotalBytes: 100},
+			sessions: []*session{
+				{id: "running", userID: 1, status: data.StatusRunning, bytes: 50, createdAt: ago(4 * time.Hour)},
+				{id: "oldest", userID: 1, status: data.StatusComplete, bytes: 50, createdAt: ago(3 * time.Hour)},
+				{id: "older", userID: 2, status: data.StatusComplete, bytes: 50, createdAt: ago(2 * time.Hour)},
+				{id: "new", userID: 2, status: data.StatusComplete, bytes: 50, createdAt: ago(time.Hour)},
+			},
+			want: map[string]string{"oldest": ReasonDiskBudget, "older": ReasonDiskBudget},
+		},
+		{
+			name:   "no limits",
+			policy: Policy{},
+			sessions: []*session{
+				{id: "old", userID: 1, status: data.StatusComplete, bytes: 1 << 30, createdAt: ago(1000 * time.Hour)},
+			},
+			want: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := New(nil, tt.policy, nil)
+
+			got := make(map[string]string)
+			for _, e := range j.plan(tt.sessions, now) {
+				got[e.SessionID] = e.Reason
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expired = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSweepWorkDirs(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * orphanGrace)
+
+	for _, id := range []string{"crashed", "running", "fresh", ".tmp"} {
+		p := filepath.Join(dir, id, "app")
+		if err := os.MkdirAll(p, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(p, "main.go"), []byte("package main\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if id == "fresh" {
+			continue
+		}
+		for _, q := range []string{filepath.Join(p, "main.go"), p, filepath.Join(dir, id)} {
+			if err := os.Chtimes(q, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	j := New(nil, Policy{}, nil)
+	j.SetWorkDir(dir, func(id string) bool { return id == "running" })
+
+	for _, dryRun := range []bool{true, false} {
+		report := &Report{DryRun: dryRun, StartedAt: time.Now()}
+		j.sweepWorkDirs(report, dryRun)
+
+		if len(report.Errors) > 0 {
+			t.Fatalf("errors: %v", report.Errors)
+		}
+		if !reflect.DeepEqual(report.WorkDirs, []string{"crashed"}) {
+			t.Fatalf("dry run %v removed %v, want [crashed]", dryRun, report.WorkDirs)
+		}
+		if report.FreedBytes != int64(len("package main\n")) {
+			t.Errorf("freed %d bytes, want %d", report.FreedBytes, len("package main\n"))
+		}
+
+		_, err := os.Stat(filepath.Join(dir, "crashed"))
+		if dryRun && err != nil {
+			t.Fatalf("dry run removed the directory: %v", err)
+		}
+		if !dryRun && !os.IsNotExist(err) {
+			t.Fatalf("directory was not removed: %v", err)
+		}
+	}
+
+	for _, id := range []string{"running", "fresh", ".tmp"} {
+		if _, err := os.Stat(filepath.Join(dir, id)); err != nil {
+			t.Errorf("%s was removed: %v", id, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -10,6 +11,7 @@ import (
 	"net/http/cookiejar"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
@@ -24,10 +26,41 @@ type MCPgreenlightServer struct {
 
 // APIResponse represents a generic API response
 type ApiResponse struct {
-	Status  int                    `json:"status"`
-	Data    interface{}            `json:"data,omitempty"`
-	Error   string                 `json:"error,omitempty"`
-	Headers map[string]interface{} `json:"headers,omitempty"`
+	Status    int                    `json:"status"`
+	Data      interface{}            `json:"data,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	Code      string                 `json:"code,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Headers   map[string]interface{} `json:"headers,omitempty"`
+}
+
+// setError fills in the error of a failed request from the API's error
+// envelope, or from the raw body when it isn't one.
+func (r *ApiResponse) setError(body []byte) {
+	var env struct {
+		Error     interface{} `json:"error"`
+		Code      string      `json:"code"`
+		RequestID string      `json:"request_id"`
+	}
+	if err := json.Unmarshal(body, &env); err != nil || env.Error == nil {
+		r.Error = strings.TrimSpace(string(body))
+		return
+	}
+
+	r.Code = env.Code
+	r.RequestID = env.RequestID
+	if message, ok := env.Error.(string); ok {
+		r.Error = message
+	} else {
+		// Field errors of failed validations.
+		fields, _ := json.Marshal(env.Error)
+		r.Error = string(fields)
+	}
+}
+
+// failed reports whether the request failed, for the tool result's IsError.
+func (r *ApiResponse) failed() bool {
+	return r.Status == 0 || r.Status >= http.StatusBadRequest || r.Error != ""
 }
 
 // LoginRequest represents the login payload
@@ -38,12 +71,28 @@ type LoginRequest struct {
 
 // GenerateRequest represents the code generation payload
 type GenerateRequest struct {
-	Language    string `json:"language"`
-	Template    string `json:"template"`
-	BasePackage string `json:"base_package"`
-	ProjectName string `json:"project_name"`
-	Model       string `json:"model"`
-	Prompt      string `json:"prompt"`
+	Language    string    `json:"language"`
+	Template    string    `json:"template"`
+	BasePackage string    `json:"basePackage"`
+	ProjectName string    `json:"projectName"`
+	Model       string    `json:"model"`
+	Prompt      string    `json:"prompt"`
+	WithTests   bool      `json:"withTests,omitempty"`
+	Protocol    string    `json:"protocol,omitempty"`
+	Sampling    *Sampling `json:"sampling,omitempty"`
+
+	License       string `json:"license,omitempty"`
+	LicenseHolder string `json:"licenseHolder,omitempty"`
+}
+
+// Sampling holds the optional sampling parameters of a generation.
+type Sampling struct {
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	MaxTokens       *int     `json:"maxTokens,omitempty"`
+	Seed            *int64   `json:"seed,omitempty"`
+	Stop            []string `json:"stop,omitempty"`
+	ReasoningEffort string   `json:"reasoningEffort,omitempty"`
 }
 
 func NewMCPgreenlightServer() *MCPgreenlightServer {
@@ -171,11 +220,15 @@ func (s *MCPgreenlightServer) makeRequest(method, endpoint string, data interfac
 		}
 	}
 
-	return &ApiResponse{
+	result := &ApiResponse{
 		Status:  resp.StatusCode,
 		Data:    jsonResult,
 		Headers: headerMap,
-	}, nil
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		result.setError(respBody)
+	}
+	return result, nil
 }
 
 func (s *MCPgreenlightServer) RegisterTools() {
@@ -204,6 +257,22 @@ func (s *MCPgreenlightServer) RegisterTools() {
 	logoutTool := mcp.NewTool("user-logout",
 		mcp.WithDescription("Logout current user"),
 	)
+	// Models tool
+	modelsTool := mcp.NewTool("list-models",
+		mcp.WithDescription("List the models available for code generation with their limits, pricing and capabilities"),
+	)
+
+	sessionTreeTool := mcp.NewTool("session-tree",
+		mcp.WithDescription("List the files of a generated project with their sizes (requires login)"),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID returned by code-generate")),
+	)
+
+	sessionFileTool := mcp.NewTool("session-file",
+		mcp.WithDescription("Read a file of a generated project (requires login)"),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID returned by code-generate")),
+		mcp.WithString("path", mcp.Required(), mcp.Description("Path of the file within the project, as listed by session-tree")),
+	)
+
 	// Generate code tool
 	generateTool := mcp.NewTool("code-generate",
 		mcp.WithDescription("Generate code using AI (requires login)"),
@@ -211,8 +280,18 @@ func (s *MCPgreenlightServer) RegisterTools() {
 		mcp.WithString("template", mcp.Required(), mcp.Description("Project template")),
 		mcp.WithString("base_package", mcp.Required(), mcp.Description("Base package name")),
 		mcp.WithString("project_name", mcp.Required(), mcp.Description("Project name")),
-		mcp.WithString("model", mcp.Required(), mcp.Description("AI model to use")),
+		mcp.WithString("model", mcp.Required(), mcp.Description("AI model to use, one of those returned by list-models")),
 		mcp.WithString("prompt", mcp.Required(), mcp.Description("Generation prompt")),
+		mcp.WithBoolean("with_tests", mcp.Description("Also generate unit tests for the generated code")),
+		mcp.WithString("protocol", mcp.Description("How the model returns files: delimited, json, json_schema or tools")),
+		mcp.WithNumber("temperature", mcp.Description("Sampling temperature")),
+		mcp.WithNumber("top_p", mcp.Description("Nucleus sampling probability mass")),
+		mcp.WithNumber("max_tokens", mcp.Description("Maximum tokens per response")),
+		mcp.WithNumber("seed", mcp.Description("Seed for best-effort deterministic sampling")),
+		mcp.WithArray("stop", mcp.WithStringItems(), mcp.Description("Stop sequences")),
+		mcp.WithString("reasoning_effort", mcp.Description("Reasoning effort for reasoning models: minimal, low, medium or high")),
+		mcp.WithString("license", mcp.Description("SPDX identifier of the LICENSE to add (MIT, BSD-2-Clause, BSD-3-Clause, ISC or Unlicense) or none")),
+		mcp.WithString("license_holder", mcp.Description("Copyright holder named in the LICENSE")),
 	)
 
 	// Register all tools
@@ -220,7 +299,10 @@ func (s *MCPgreenlightServer) RegisterTools() {
 	srv.AddTool(loginTool, s.handleLogin)
 	srv.AddTool(meTool, s.handleMe)
 	srv.AddTool(logoutTool, s.handleLogout)
+	srv.AddTool(modelsTool, s.handleListModels)
 	srv.AddTool(generateTool, s.handleGenerate)
+	srv.AddTool(sessionTreeTool, s.handleSessionTree)
+	srv.AddTool(sessionFileTool, s.handleSessionFile)
 
 	// Start MCP stdio server
 	if err := server.ServeStdio(srv); err != nil {
@@ -236,6 +318,18 @@ func (s *MCPgreenlightServer) handleGenerate(ctx context.Context, request mcp.Ca
 		ProjectName string `json:"project_name"`
 		Model       string `json:"model"`
 		Prompt      string `json:"prompt"`
+		WithTests   bool   `json:"with_tests"`
+		Protocol    string `json:"protocol"`
+
+		Temperature     *float64 `json:"temperature"`
+		TopP            *float64 `json:"top_p"`
+		MaxTokens       *int     `json:"max_tokens"`
+		Seed            *int64   `json:"seed"`
+		Stop            []string `json:"stop"`
+		ReasoningEffort string   `json:"reasoning_effort"`
+
+		License       string `json:"license"`
+		LicenseHolder string `json:"license_holder"`
 	}
 
 	argsBytes, err := json.Marshal(request.Params.Arguments)
@@ -270,9 +364,21 @@ func (s *MCPgreenlightServer) handleGenerate(ctx context.Context, request mcp.Ca
 		ProjectName: args.ProjectName,
 		Model:       args.Model,
 		Prompt:      args.Prompt,
+		WithTests:   args.WithTests,
+		Protocol:    args.Protocol,
+		Sampling: &Sampling{
+			Temperature:     args.Temperature,
+			TopP:            args.TopP,
+			MaxTokens:       args.MaxTokens,
+			Seed:            args.Seed,
+			Stop:            args.Stop,
+			ReasoningEffort: args.ReasoningEffort,
+		},
+		License:       args.License,
+		LicenseHolder: args.LicenseHolder,
 	}
 
-	result, err := s.makeRequest("POST", "/generate-http", generateData, nil)
+	result, err := s.generateStream(ctx, request, generateData)
 	if err != nil {
 		return &mcp.CallToolResult{
 			IsError: true,
@@ -287,6 +393,7 @@ func (s *MCPgreenlightServer) handleGenerate(ctx context.Context, request mcp.Ca
 
 	response, _ := json.MarshalIndent(result, "", "  ")
 	return &mcp.CallToolResult{
+		IsError: result.failed(),
 		Content: []mcp.Content{
 			mcp.TextContent{
 				Type: "text",
@@ -296,6 +403,88 @@ func (s *MCPgreenlightServer) handleGenerate(ctx context.Context, request mcp.Ca
 	}, nil
 }
 
+// generateStream posts a generate request asking for Server-Sent Events and
+// forwards the progress events to the MCP client as progress notifications.
+// It returns the final complete or error event.
+func (s *MCPgreenlightServer) generateStream(ctx context.Context, request mcp.CallToolRequest, data GenerateRequest) (*ApiResponse, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request data: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.apiBaseUrl+"/generate-http", bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+
+	// Generations take minutes, longer than the default client allows.
+	client := &http.Client{Jar: s.jar}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		body, _ := io.ReadAll(resp.Body)
+		result := &ApiResponse{Status: resp.StatusCode}
+		result.setError(body)
+		return result, nil
+	}
+
+	var progressToken mcp.ProgressToken
+	if request.Params.Meta != nil {
+		progressToken = request.Params.Meta.ProgressToken
+	}
+	mcpServer := server.ServerFromContext(ctx)
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	progress := 0
+	for scanner.Scan() {
+		payload, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			continue
+		}
+
+		switch event["type"] {
+		case "complete":
+			return &ApiResponse{Status: resp.StatusCode, Data: event}, nil
+		case "error":
+			message, _ := event["message"].(string)
+			return &ApiResponse{Status: resp.StatusCode, Data: event, Error: message}, nil
+		}
+
+		if progressToken == nil || mcpServer == nil {
+			continue
+		}
+
+		progress++
+		message, _ := event["message"].(string)
+		if file, _ := event["file"].(string); file != "" {
+			message = strings.TrimSpace(message + " " + file)
+		}
+		mcpServer.SendNotificationToClient(ctx, "notifications/progress", map[string]any{
+			"progressToken": progressToken,
+			"progress":      progress,
+			"message":       fmt.Sprintf("[%v] %s", event["type"], message),
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("event stream ended without a result")
+}
+
 func (s *MCPgreenlightServer) handleLogin(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	var args struct {
 		Email    string `json:"email"`
@@ -348,6 +537,7 @@ func (s *MCPgreenlightServer) handleLogin(ctx context.Context, request mcp.CallT
 
 	response, _ := json.MarshalIndent(result, "", "  ")
 	return &mcp.CallToolResult{
+		IsError: result.failed(),
 		Content: []mcp.Content{
 			mcp.TextContent{
 				Type: "text",
@@ -374,6 +564,7 @@ func (s *MCPgreenlightServer) handleMe(ctx context.Context, request mcp.CallTool
 
 	response, _ := json.MarshalIndent(result, "", "  ")
 	return &mcp.CallToolResult{
+		IsError: result.failed(),
 		Content: []mcp.Content{
 			mcp.TextContent{
 				Type: "text",
@@ -400,6 +591,7 @@ func (s *MCPgreenlightServer) handleLogout(ctx context.Context, request mcp.Call
 
 	response, _ := json.MarshalIndent(result, "", "  ")
 	return &mcp.CallToolResult{
+		IsError: result.failed(),
 		Content: []mcp.Content{
 			mcp.TextContent{
 				Type: "text",
@@ -446,6 +638,7 @@ func (s *MCPgreenlightServer) healthToolHandler(ctx context.Context, request mcp
 
 	response, _ := json.MarshalIndent(result, "", "  ")
 	return &mcp.CallToolResult{
+		IsError: result.failed(),
 		Content: []mcp.Content{
 			mcp.TextContent{
 				Type: "text",
@@ -459,3 +652,97 @@ func main() {
 	srv := NewMCPgreenlightServer()
 	srv.RegisterTools()
 }
+
+func (s *MCPgreenlightServer) handleListModels(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	result, err := s.makeRequest("GET", "/models", nil, nil)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{
+					Type: "text",
+					Text: fmt.Sprintf("Models request failed: %v", err),
+				},
+			},
+		}, nil
+	}
+
+	response, _ := json.MarshalIndent(result, "", "  ")
+	return &mcp.CallToolResult{
+		IsError: result.failed(),
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(response),
+			},
+		},
+	}, nil
+}
+
+func (s *MCPgreenlightServer) handleSessionTree(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return s.handleSession(request, func(sessionID, _ string) string {
+		return "/sessions/" + url.PathEscape(sessionID) + "/tree"
+	})
+}
+
+func (s *MCPgreenlightServer) handleSessionFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return s.handleSession(request, func(sessionID, filePath string) string {
+		segments := strings.Split(strings.Trim(filePath, "/"), "/")
+		for i, seg := range segments {
+			segments[i] = url.PathEscape(seg)
+		}
+		return "/sessions/" + url.PathEscape(sessionID) + "/files/" + strings.Join(segments, "/")
+	})
+}
+
+// handleSession fetches one of the session endpoints built by endpoint from
+// the tool's session_id and path arguments.
+func (s *MCPgreenlightServer) handleSession(request mcp.CallToolRequest, endpoint func(sessionID, filePath string) string) (*mcp.CallToolResult, error) {
+	var args struct {
+		SessionID string `json:"session_id"`
+		Path      string `json:"path"`
+	}
+
+	argsBytes, err := json.Marshal(request.Params.Arguments)
+	if err == nil {
+		err = json.Unmarshal(argsBytes, &args)
+	}
+	if err == nil && args.SessionID == "" {
+		err = fmt.Errorf("session_id is required")
+	}
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{
+					Type: "text",
+					Text: fmt.Sprintf("Invalid arguments: %v", err),
+				},
+			},
+		}, nil
+	}
+
+	result, err := s.makeRequest("GET", endpoint(args.SessionID, args.Path), nil, nil)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{
+					Type: "text",
+					Text: fmt.Sprintf("Session request failed: %v", err),
+				},
+			},
+		}, nil
+	}
+
+	response, _ := json.MarshalIndent(result, "", "  ")
+	return &mcp.CallToolResult{
+		IsError: result.failed(),
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(response),
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,177 @@
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConflictError lists the files whose hunks no longer match what is on disk.
+type ConflictError struct {
+	Conflicts map[string]string
+}
+
+func (e *ConflictError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "patch does not apply cleanly to %d file(s):", len(e.Conflicts))
+	for path, reason := range e.Conflicts {
+		fmt.Fprintf(&b, "\n  %s: %s", path, reason)
+	}
+	return b.String()
+}
+
+// Apply applies diffs to the tree rooted at root. Every file is checked
+// before anything is written, so a conflict in one file leaves the whole
+// tree untouched. It returns the paths it wrote or removed.
+func Apply(root string, diffs []*FileDiff) ([]string, error) {
+	results := make(map[string]string)
+	var removals []string
+	conflicts := make(map[string]string)
+
+	for _, fd := range diffs {
+		name := fd.Path()
+		path, err := safePath(root, name)
+		if err != nil {
+			conflicts[name] = err.Error()
+			continue
+		}
+
+		current, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			if !fd.IsNew() {
+				conflicts[name] = "file does not exist"
+				continue
+			}
+		case err != nil:
+			conflicts[name] = err.Error()
+			continue
+		case fd.IsNew():
+			// The file appeared since the patch was made. It's only safe if it
+			// already has the content the patch would create.
+			if want, ok := applyHunks(nil, fd.Hunks); !ok || strings.Join(want, "") != string(current) {
+				conflicts[name] = "file already exists"
+			}
+			continue
+		}
+
+		lines, ok := applyHunks(splitLines(string(current)), fd.Hunks)
+		if !ok {
+			conflicts[name] = "hunk context does not match"
+			continue
+		}
+
+		if fd.IsDeleted() {
+			// Only files holding exactly what the patch removes go.
+			if len(lines) > 0 {
+				conflicts[name] = "file has content the patch does not remove"
+				continue
+			}
+			removals = append(removals, path)
+			continue
+		}
+
+		results[path] = strings.Join(lines, "")
+	}
+
+	if len(conflicts) > 0 {
+		return nil, &ConflictError{Conflicts: conflicts}
+	}
+
+	var written []string
+	for _, path := range removals {
+		if err := os.Remove(path); err != nil {
+			return written, fmt.Errorf("error removing file %s: %w", path, err)
+		}
+		written = append(written, path)
+	}
+	for path, content := range results {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return written, fmt.Errorf("error creating directories: %s: %w", path, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return written, fmt.Errorf("error writing file %s: %w", path, err)
+		}
+		written = append(written, path)
+	}
+
+	return written, nil
+}
+
+// applyHunks returns the patched lines, or false if a hunk cannot be placed.
+// Hunks are located near their recorded position first and then anywhere
+// after the previous hunk, which tolerates small edits above them.
+func applyHunks(lines []string, hunks []Hunk) ([]string, bool) {
+	var out []string
+	pos := 0
+
+	for _, h := range hunks {
+		var old, replacement []string
+		for _, line := range h.Lines {
+			switch line[0] {
+			case ' ':
+				old = append(old, line[1:])
+				replacement = append(replacement, line[1:])
+			case '-':
+				old = append(old, line[1:])
+			case '+':
+				replacement = append(replacement, line[1:])
+			}
+		}
+
+		at := findBlock(lines, old, pos, max(h.OldStart-1, pos))
+		if at < 0 {
+			return nil, false
+		}
+
+		out = append(out, lines[pos:at]...)
+		out = append(out, replacement...)
+		pos = at + len(old)
+	}
+
+	return append(out, lines[pos:]...), true
+}
+
+// findBlock searches for block in lines at or after from, trying hint first
+// and then widening outwards from it.
+func findBlock(lines, block []string, from, hint int) int {
+	matches := func(at int) bool {
+		if at < from || at+len(block) > len(lines) {
+			return false
+		}
+		for i, line := range block {
+			if lines[at+i] != line {
+				return false
+			}
+		}
+		return true
+	}
+
+	for delta := 0; delta <= max(hint, len(lines)); delta++ {
+		if matches(hint + delta) {
+			return hint + delta
+		}
+		if delta > 0 && matches(hint-delta) {
+			return hint - delta
+		}
+	}
+
+	return -1
+}
+
+// safePath joins a patch path onto root, refusing paths that escape it.
+func safePath(root, p string) (string, error) {
+	if p == "" || filepath.IsAbs(p) {
+		return "", fmt.Errorf("invalid path %q", p)
+	}
+
+	full := filepath.Join(root, filepath.FromSlash(p))
+	rel, err := filepath.Rel(root, full)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q escapes %s", p, root)
+	}
+
+	return full, nil
+}
@@ -0,0 +1,309 @@
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const contextLines = 3
+
+// maxLCSCells bounds the table diffLines allocates, about 64 MiB. Larger
+// changes are diffed as a replacement of every line that differs.
+const maxLCSCells = 16 << 20
+
+// FileDiff is the set of changes to a single file.
+type FileDiff struct {
+	OldPath string
+	NewPath string
+	Hunks   []Hunk
+}
+
+// IsNew reports whether the diff creates a file that did not exist before.
+func (f FileDiff) IsNew() bool {
+	return f.OldPath == ""
+}
+
+// IsDeleted reports whether the diff removes the file.
+func (f FileDiff) IsDeleted() bool {
+	return f.NewPath == ""
+}
+
+// Path is the path of the file the diff changes.
+func (f FileDiff) Path() string {
+	if f.IsDeleted() {
+		return f.OldPath
+	}
+	return f.NewPath
+}
+
+// Hunk is a contiguous block of changes. Lines keep their diff prefix
+// (' ', '-' or '+') and their trailing newline, if any.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []string
+}
+
+type op struct {
+	kind byte
+	line string
+}
+
+// splitLines splits content into lines that keep their "\n" terminator.
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Diff compares old and new content for path and returns nil when they are
+// identical. An empty oldContent with exists set to false produces a new
+// file diff.
+func Diff(path, oldContent, newContent string, exists bool) *FileDiff {
+	if exists && oldContent == newContent {
+		return nil
+	}
+
+	fd := &FileDiff{OldPath: path, NewPath: path}
+	if !exists {
+		fd.OldPath = ""
+	}
+
+	ops := diffLines(splitLines(oldContent), splitLines(newContent))
+	fd.Hunks = buildHunks(ops)
+
+	return fd
+}
+
+// Compare diffs generated files, keyed by path relative to root, against the
+// files currently on disk. Files on disk that were not generated are left
+// out of the result.
+func Compare(root string, files map[string]string) ([]*FileDiff, error) {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var diffs []*FileDiff
+	for _, p := range paths {
+		full, err := safePath(root, p)
+		if err != nil {
+			return nil, err
+		}
+
+		exists := true
+		current, err := os.ReadFile(full)
+		if errors.Is(err, os.ErrNotExist) {
+			exists = false
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", full, err)
+		}
+
+		if fd := Diff(p, string(current), files[p], exists); fd != nil {
+			diffs = append(diffs, fd)
+		}
+	}
+
+	return diffs, nil
+}
+
+// diffLines computes a line edit script using the longest common
+// subsequence of the two inputs after trimming their shared prefix and
+// suffix. When the remaining lines are too many to compare pairwise, they
+// are all removed and added instead.
+func diffLines(a, b []string) []op {
+	var prefix, suffix []op
+
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, op{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append([]op{{' ', a[len(a)-1]}}, suffix...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	n, m := len(a), len(b)
+	if (n+1)*(m+1) > maxLCSCells {
+		ops := prefix
+		for _, line := range a {
+			ops = append(ops, op{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, op{'+', line})
+		}
+		return append(ops, suffix...)
+	}
+
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := prefix
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, op{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, op{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, op{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, op{'+', b[j]})
+	}
+
+	return append(ops, suffix...)
+}
+
+// buildHunks groups an edit script into hunks with surrounding context.
+func buildHunks(ops []op) []Hunk {
+	var hunks []Hunk
+
+	oldLine, newLine := 1, 1
+	i := 0
+	for i < len(ops) {
+		if ops[i].kind == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		start := max(i-contextLines, 0)
+		h := Hunk{
+			OldStart: oldLine - (i - start),
+			NewStart: newLine - (i - start),
+		}
+
+		for k := start; k < i; k++ {
+			h.Lines = append(h.Lines, " "+ops[k].line)
+			h.OldLines++
+			h.NewLines++
+		}
+
+		// Extend the hunk until contextLines*2 unchanged lines separate it
+		// from the next change.
+		for i < len(ops) {
+			if ops[i].kind == ' ' {
+				run := 0
+				for i+run < len(ops) && ops[i+run].kind == ' ' {
+					run++
+				}
+				if i+run == len(ops) || run > contextLines*2 {
+					for k := 0; k < min(run, contextLines); k++ {
+						h.Lines = append(h.Lines, " "+ops[i+k].line)
+						h.OldLines++
+						h.NewLines++
+					}
+					break
+				}
+				for k := 0; k < run; k++ {
+					h.Lines = append(h.Lines, " "+ops[i].line)
+					h.OldLines++
+					h.NewLines++
+					oldLine++
+					newLine++
+					i++
+				}
+				continue
+			}
+
+			h.Lines = append(h.Lines, string(ops[i].kind)+ops[i].line)
+			if ops[i].kind == '-' {
+				h.OldLines++
+				oldLine++
+			} else {
+				h.NewLines++
+				newLine++
+			}
+			i++
+		}
+
+		if h.OldLines == 0 {
+			h.OldStart--
+		}
+		if h.NewLines == 0 {
+			h.NewStart--
+		}
+
+		hunks = append(hunks, h)
+	}
+
+	return hunks
+}
+
+// Format renders diffs as a git-style patch.
+func Format(diffs []*FileDiff) string {
+	var b strings.Builder
+
+	for _, fd := range diffs {
+		fmt.Fprintf(&b, "diff --git a/%s b/%s\n", fd.Path(), fd.Path())
+		switch {
+		case fd.IsNew():
+			b.WriteString("new file mode 100644\n")
+			b.WriteString("--- /dev/null\n")
+		case fd.IsDeleted():
+			b.WriteString("deleted file mode 100644\n")
+			fmt.Fprintf(&b, "--- a/%s\n", fd.OldPath)
+		default:
+			fmt.Fprintf(&b, "--- a/%s\n", fd.OldPath)
+		}
+		if fd.IsDeleted() {
+			b.WriteString("+++ /dev/null\n")
+		} else {
+			fmt.Fprintf(&b, "+++ b/%s\n", fd.NewPath)
+		}
+
+		for _, h := range fd.Hunks {
+			fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+			for _, line := range h.Lines {
+				b.WriteString(line)
+				if !strings.HasSuffix(line, "\n") {
+					b.WriteString("\n\\ No newline at end of file\n")
+				}
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
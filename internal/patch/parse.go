@@ -0,0 +1,127 @@
+package patch
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var hunkHeaderRegex = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// Parse reads a unified or git-style patch.
+func Parse(patch string) ([]*FileDiff, error) {
+	var diffs []*FileDiff
+	var current *FileDiff
+	var hunk *Hunk
+	// headed holds the diffs whose +++ header was seen.
+	headed := make(map[*FileDiff]bool)
+
+	flushHunk := func() {
+		if current != nil && hunk != nil {
+			current.Hunks = append(current.Hunks, *hunk)
+		}
+		hunk = nil
+	}
+
+	lines := splitLines(patch)
+	for n, raw := range lines {
+		line := strings.TrimSuffix(raw, "\n")
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flushHunk()
+			current = nil
+
+		case strings.HasPrefix(line, "--- ") && (hunk == nil || hunk.remaining() == 0):
+			flushHunk()
+			current = &FileDiff{OldPath: stripPathPrefix(line[4:], "a/")}
+			diffs = append(diffs, current)
+
+		case strings.HasPrefix(line, "+++ ") && current != nil && hunk == nil:
+			current.NewPath = stripPathPrefix(line[4:], "b/")
+			headed[current] = true
+
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: hunk without file header", n+1)
+			}
+			flushHunk()
+
+			m := hunkHeaderRegex.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: malformed hunk header %q", n+1, line)
+			}
+			hunk = &Hunk{
+				OldStart: atoi(m[1], 0),
+				OldLines: atoi(m[2], 1),
+				NewStart: atoi(m[3], 0),
+				NewLines: atoi(m[4], 1),
+			}
+
+		case strings.HasPrefix(line, `\ No newline at end of file`):
+			if hunk != nil && len(hunk.Lines) > 0 {
+				last := len(hunk.Lines) - 1
+				hunk.Lines[last] = strings.TrimSuffix(hunk.Lines[last], "\n")
+			}
+
+		case hunk != nil && len(line) > 0 && strings.ContainsRune(" +-", rune(line[0])):
+			hunk.Lines = append(hunk.Lines, raw)
+
+		case hunk != nil && line == "":
+			// Some tools strip the space from empty context lines.
+			hunk.Lines = append(hunk.Lines, " \n")
+		}
+	}
+	flushHunk()
+
+	for _, fd := range diffs {
+		if !headed[fd] {
+			return nil, fmt.Errorf("patch for %s has no +++ header", fd.OldPath)
+		}
+		if fd.IsNew() && fd.IsDeleted() {
+			return nil, fmt.Errorf("patch has neither an old nor a new path")
+		}
+	}
+
+	return diffs, nil
+}
+
+// remaining returns how many old or new lines the hunk header still expects.
+func (h *Hunk) remaining() int {
+	oldSeen, newSeen := 0, 0
+	for _, line := range h.Lines {
+		switch line[0] {
+		case ' ':
+			oldSeen++
+			newSeen++
+		case '-':
+			oldSeen++
+		case '+':
+			newSeen++
+		}
+	}
+	return max(h.OldLines-oldSeen, h.NewLines-newSeen)
+}
+
+func stripPathPrefix(p, prefix string) string {
+	p = strings.TrimSpace(p)
+	if i := strings.IndexByte(p, '\t'); i >= 0 {
+		p = p[:i]
+	}
+	if p == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(p, prefix)
+}
+
+func atoi(s string, def int) int {
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return def
+	}
+	return n
+}
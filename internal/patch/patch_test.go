@@ -0,0 +1,295 @@
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// numbered returns lines "line 1\n" to "line n\n".
+func numbered(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(t *testing.T, root, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRoundTrip(t *testing.T) {
+	long := numbered(40)
+	// Too many changed lines to compare pairwise.
+	huge := numbered(5000)
+	rewritten := strings.ReplaceAll(huge, "line", "row")
+
+	tests := []struct {
+		name   string
+		old    string
+		new    string
+		exists bool
+		hunks  int
+	}{
+		{name: "change in the middle", old: numbered(10), new: strings.Replace(numbered(10), "line 5\n", "line five\n", 1), exists: true, hunks: 1},
+		{name: "insert at the start", old: numbered(5), new: "header\n" + numbered(5), exists: true, hunks: 1},
+		{name: "append", old: numbered(5), new: numbered(7), exists: true, hunks: 1},
+		{name: "remove lines", old: numbered(8), new: strings.Replace(numbered(8), "line 3\nline 4\n", "", 1), exists: true, hunks: 1},
+		{name: "distant changes", old: long, new: strings.Replace(strings.Replace(long, "line 2\n", "two\n", 1), "line 38\n", "thirty-eight\n", 1), exists: true, hunks: 2},
+		{name: "close changes", old: long, new: strings.Replace(strings.Replace(long, "line 10\n", "ten\n", 1), "line 15\n", "fifteen\n", 1), exists: true, hunks: 1},
+		{name: "no newline at end", old: "a\nb\n", new: "a\nb\nc", exists: true, hunks: 1},
+		{name: "newline added at end", old: "a\nb", new: "a\nb\n", exists: true, hunks: 1},
+		{name: "emptied", old: numbered(3), new: "", exists: true, hunks: 1},
+		{name: "large rewrite", old: "head\n" + huge + "tail\n", new: "head\n" + rewritten + "tail\n", exists: true, hunks: 1},
+		{name: "new file", new: numbered(3), hunks: 1},
+		{name: "new empty file", new: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fd := Diff("dir/file.txt", tt.old, tt.new, tt.exists)
+			if fd == nil {
+				t.Fatal("Diff returned nil for different contents")
+			}
+			if len(fd.Hunks) != tt.hunks {
+				t.Errorf("got %d hunks, want %d", len(fd.Hunks), tt.hunks)
+			}
+			if fd.IsNew() == tt.exists {
+				t.Errorf("IsNew = %v for exists = %v", fd.IsNew(), tt.exists)
+			}
+
+			text := Format([]*FileDiff{fd})
+			parsed, err := Parse(text)
+			if err != nil {
+				t.Fatalf("Parse: %v\n%s", err, text)
+			}
+			if !reflect.DeepEqual(parsed, []*FileDiff{fd}) {
+				t.Fatalf("Parse(Format(d)) = %+v, want %+v\n%s", parsed[0], fd, text)
+			}
+
+			root := t.TempDir()
+			if tt.exists {
+				writeFiles(t, root, map[string]string{"dir/file.txt": tt.old})
+			}
+			if _, err := Apply(root, parsed); err != nil {
+				t.Fatalf("Apply: %v\n%s", err, text)
+			}
+			if got := readFile(t, root, "dir/file.txt"); got != tt.new {
+				t.Errorf("applied content = %q, want %q", got, tt.new)
+			}
+		})
+	}
+}
+
+func TestDiffIdentical(t *testing.T) {
+	if fd := Diff("a.txt", "same\n", "same\n", true); fd != nil {
+		t.Errorf("Diff of identical content = %+v, want nil", fd)
+	}
+}
+
+func TestHunkHeaders(t *testing.T) {
+	old := numbered(20)
+	new := strings.Replace(old, "line 10\n", "ten\nten and a half\n", 1)
+
+	text := Format([]*FileDiff{Diff("f.txt", old, new, true)})
+	if !strings.Contains(text, "@@ -7,7 +7,8 @@\n") {
+		t.Errorf("patch has the wrong hunk header:\n%s", text)
+	}
+
+	text = Format([]*FileDiff{Diff("f.txt", "", "only\n", false)})
+	if !strings.Contains(text, "--- /dev/null\n+++ b/f.txt\n@@ -0,0 +1 @@\n+only\n") {
+		t.Errorf("new file patch is malformed:\n%s", text)
+	}
+}
+
+func TestApplyOffsetHunks(t *testing.T) {
+	old := numbered(30)
+	new := strings.Replace(old, "line 20\n", "twenty\n", 1)
+	diffs := []*FileDiff{Diff("f.txt", old, new, true)}
+
+	tests := []struct {
+		name    string
+		current string
+		want    string
+	}{
+		{name: "lines added above", current: "a\nb\nc\n" + old, want: "a\nb\nc\n" + new},
+		{name: "lines removed above", current: strings.Replace(old, "line 1\nline 2\n", "", 1), want: strings.Replace(new, "line 1\nline 2\n", "", 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, map[string]string{"f.txt": tt.current})
+
+			if _, err := Apply(root, diffs); err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if got := readFile(t, root, "f.txt"); got != tt.want {
+				t.Errorf("applied content = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyConflictLeavesTreeUntouched(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.txt": numbered(5),
+		"b.txt": "changed by someone else\n",
+	})
+
+	diffs := []*FileDiff{
+		Diff("a.txt", numbered(5), numbered(6), true),
+		Diff("b.txt", numbered(5), numbered(6), true),
+		Diff("c.txt", "", "new\n", false),
+	}
+
+	_, err := Apply(root, diffs)
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("Apply error = %v, want a ConflictError", err)
+	}
+	if _, ok := conflict.Conflicts["b.txt"]; !ok || len(conflict.Conflicts) != 1 {
+		t.Errorf("conflicts = %v, want only b.txt", conflict.Conflicts)
+	}
+
+	if got := readFile(t, root, "a.txt"); got != numbered(5) {
+		t.Errorf("a.txt was changed to %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "c.txt")); !os.IsNotExist(err) {
+		t.Errorf("c.txt was created: %v", err)
+	}
+}
+
+func TestNewAndDeletedFiles(t *testing.T) {
+	const text = `diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+--- a/gone.txt
++++ /dev/null
+@@ -1,2 +0,0 @@
+-one
+-two
+diff --git a/added.txt b/added.txt
+new file mode 100644
+--- /dev/null
++++ b/added.txt
+@@ -0,0 +1 @@
++hello
+`
+
+	diffs, err := Parse(text)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(diffs) != 2 || !diffs[0].IsDeleted() || diffs[0].Path() != "gone.txt" || !diffs[1].IsNew() || diffs[1].Path() != "added.txt" {
+		t.Fatalf("parsed %+v %+v, want a deletion of gone.txt and a new added.txt", diffs[0], diffs[1])
+	}
+	if got := Format(diffs); got != text {
+		t.Errorf("Format(Parse(p)) =\n%s\nwant\n%s", got, text)
+	}
+
+	t.Run("apply", func(t *testing.T) {
+		root := t.TempDir()
+		writeFiles(t, root, map[string]string{"gone.txt": "one\ntwo\n"})
+
+		if _, err := Apply(root, diffs); err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(root, "gone.txt")); !os.IsNotExist(err) {
+			t.Errorf("gone.txt still exists: %v", err)
+		}
+		if got := readFile(t, root, "added.txt"); got != "hello\n" {
+			t.Errorf("added.txt = %q, want hello", got)
+		}
+	})
+
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{name: "deleted file has more content", files: map[string]string{"gone.txt": "one\ntwo\nthree\n"}},
+		{name: "deleted file is missing", files: map[string]string{}},
+		{name: "new file already exists", files: map[string]string{"gone.txt": "one\ntwo\n", "added.txt": "other\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, tt.files)
+
+			var conflict *ConflictError
+			if _, err := Apply(root, diffs); !errors.As(err, &conflict) {
+				t.Fatalf("Apply error = %v, want a ConflictError", err)
+			}
+			for name, content := range tt.files {
+				if got := readFile(t, root, name); got != content {
+					t.Errorf("%s was changed to %q", name, got)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyRejectsEscapingPaths(t *testing.T) {
+	for _, p := range []string{"../outside.txt", "dir/../../outside.txt", "/etc/passwd", ".."} {
+		t.Run(p, func(t *testing.T) {
+			parent := t.TempDir()
+			root := filepath.Join(parent, "root")
+			if err := os.Mkdir(root, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			diffs := []*FileDiff{{NewPath: p, Hunks: []Hunk{{NewStart: 1, NewLines: 1, Lines: []string{"+pwned\n"}}}}}
+
+			var conflict *ConflictError
+			if _, err := Apply(root, diffs); !errors.As(err, &conflict) {
+				t.Fatalf("Apply error = %v, want a ConflictError", err)
+			}
+			if _, err := os.Stat(filepath.Join(parent, "outside.txt")); !os.IsNotExist(err) {
+				t.Errorf("file written outside the root: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{name: "hunk without header", patch: "@@ -1 +1 @@\n-a\n+b\n"},
+		{name: "malformed hunk header", patch: "--- a/f\n+++ b/f\n@@ -x +1 @@\n"},
+		{name: "missing +++ header", patch: "--- a/f\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diffs, err := Parse(tt.patch); err == nil {
+				t.Errorf("Parse succeeded with %+v", diffs)
+			}
+		})
+	}
+}
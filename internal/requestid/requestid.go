@@ -0,0 +1,42 @@
+// Package requestid carries the ID of an HTTP request through its context,
+// so logs and error responses can name the request they belong to.
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// Header is the header request IDs are read from and sent in.
+const Header = "X-Request-ID"
+
+type contextKey string
+
+const requestIDContextKey = contextKey("requestID")
+
+// validRX matches the request IDs accepted from clients and proxies.
+var validRX = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// FromHeader returns the request ID sent by the client or a proxy in front
+// of the server, or a new one when it sent none or an unusable one.
+func FromHeader(r *http.Request) string {
+	if id := r.Header.Get(Header); validRX.MatchString(id) {
+		return id
+	}
+	return uuid.New().String()
+}
+
+// ContextSet returns a copy of the request carrying its ID.
+func ContextSet(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// ContextGet returns the ID of the request, or "" when none was set.
+func ContextGet(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
@@ -0,0 +1,265 @@
+// Package runner executes the build and test commands of a generated project
+// in a sandbox: as a separate user, without network access, on a read-only
+// view of the host where only the project and a fresh home directory are
+// writable, and with CPU, memory and time limits.
+//
+// On Linux the sandbox is set up by an init process that re-executes the
+// running binary; importing the package is enough to make that work.
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Step is one shell command run in the project directory.
+type Step struct {
+	Stage   string `json:"stage"`
+	Command string `json:"command"`
+	// Network lets the command reach the network even when the limits
+	// don't, for fetching dependencies.
+	Network bool `json:"network,omitempty"`
+}
+
+// Limits restricts what the commands of a run may use.
+type Limits struct {
+	// Timeout bounds the wall-clock time of the whole run.
+	Timeout time.Duration
+	// CPU bounds the CPU time of each command.
+	CPU time.Duration
+	// Memory bounds the address space of each process, in bytes.
+	Memory int64
+	// UID and GID are the user the commands run as.
+	UID int
+	GID int
+	// Network keeps the host network reachable from the sandbox.
+	Network bool
+}
+
+// DefaultLimits are used by callers that don't configure their own.
+var DefaultLimits = Limits{
+	Timeout: 5 * time.Minute,
+	CPU:     2 * time.Minute,
+	Memory:  4 << 30,
+	UID:     65534,
+	GID:     65534,
+}
+
+// StepResult is the outcome of a single step.
+type StepResult struct {
+	Stage    string `json:"stage"`
+	Command  string `json:"command"`
+	ExitCode int    `json:"exitCode"`
+	Duration int64  `json:"durationMs"`
+	Output   string `json:"output"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Result is the outcome of a run. Steps stop at the first failure.
+type Result struct {
+	Passed bool         `json:"passed"`
+	Steps  []StepResult `json:"steps"`
+}
+
+// OutputFunc receives every line a command writes. stream is "stdout" or
+// "stderr".
+type OutputFunc func(stream, line string)
+
+var (
+	ErrNoSteps     = errors.New("runner: no commands to run")
+	ErrUnsupported = errors.New("runner: sandboxed execution is not supported on this platform")
+)
+
+// maxOutput is how much of the end of each step's output is kept.
+const maxOutput = 16 << 10
+
+// Run executes steps in order in dir. It returns an error only when the run
+// could not be set up; failing commands are reported in the result.
+func Run(ctx context.Context, dir string, steps []Step, limits Limits, output OutputFunc) (*Result, error) {
+	if len(steps) == 0 {
+		return nil, ErrNoSteps
+	}
+
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
+	home, err := os.MkdirTemp("", "runner-home-")
+	if err != nil {
+		return nil, fmt.Errorf("creating sandbox home: %w", err)
+	}
+	defer os.RemoveAll(home)
+
+	for _, p := range []string{home, dir} {
+		if err := grantAccess(p, limits); err != nil {
+			return nil, fmt.Errorf("granting sandbox access to %s: %w", p, err)
+		}
+	}
+
+	result := &Result{Passed: true}
+
+	for _, step := range steps {
+		stepLimits := limits
+		if step.Network {
+			stepLimits.Network = true
+		}
+
+		cmd, err := command(ctx, dir, home, step.Command, stepLimits)
+		if err != nil {
+			return nil, err
+		}
+
+		sr := runStep(cmd, step, output)
+		if ctx.Err() != nil && sr.Error == "" {
+			sr.Error = "run timed out"
+		}
+		result.Steps = append(result.Steps, sr)
+
+		if sr.ExitCode != 0 || sr.Error != "" {
+			result.Passed = false
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// Output joins the output of every step, each headed by its command.
+func (r *Result) Output() string {
+	var b strings.Builder
+	for _, s := range r.Steps {
+		fmt.Fprintf(&b, "$ %s\n%s", s.Command, s.Output)
+		if s.Error != "" {
+			fmt.Fprintf(&b, "error: %s\n", s.Error)
+		}
+	}
+	return b.String()
+}
+
+func runStep(cmd *exec.Cmd, step Step, output OutputFunc) StepResult {
+	sr := StepResult{Stage: step.Stage, Command: step.Command}
+	out := &outputCollector{output: output}
+
+	cmd.Stdout = &lineWriter{stream: "stdout", out: out}
+	cmd.Stderr = &lineWriter{stream: "stderr", out: out}
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	sr.Duration = time.Since(start).Milliseconds()
+
+	cmd.Stdout.(*lineWriter).flush()
+	cmd.Stderr.(*lineWriter).flush()
+	sr.Output = out.tail()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		sr.ExitCode = exitErr.ExitCode()
+	default:
+		sr.ExitCode = -1
+		sr.Error = err.Error()
+	}
+
+	return sr
+}
+
+// command builds the sandboxed process for a shell command. Resource limits
+// are applied with ulimit before the command replaces the shell.
+func command(ctx context.Context, dir, home, script string, limits Limits) (*exec.Cmd, error) {
+	var prelude []string
+	if limits.CPU > 0 {
+		prelude = append(prelude, fmt.Sprintf("ulimit -t %d", int64(limits.CPU.Seconds())))
+	}
+	if limits.Memory > 0 {
+		prelude = append(prelude, fmt.Sprintf("ulimit -v %d", limits.Memory>>10))
+	}
+	prelude = append(prelude, `exec /bin/sh -c "$1"`)
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", strings.Join(prelude, " && "), "sh", script)
+	cmd.Dir = dir
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + home,
+		"TMPDIR=" + home,
+		"GOPATH=" + filepath.Join(home, "go"),
+		"GOCACHE=" + filepath.Join(home, ".cache", "go-build"),
+		"GOTOOLCHAIN=local",
+		"LANG=C.UTF-8",
+		"CI=true",
+	}
+
+	if err := sandbox(cmd, limits, dir, home); err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+// outputCollector forwards lines to the caller and keeps the end of the
+// combined output.
+type outputCollector struct {
+	mu     sync.Mutex
+	buf    []byte
+	output OutputFunc
+}
+
+func (c *outputCollector) line(stream, line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.buf = append(c.buf, line...)
+	c.buf = append(c.buf, '\n')
+	if len(c.buf) > maxOutput {
+		c.buf = c.buf[len(c.buf)-maxOutput:]
+	}
+
+	if c.output != nil {
+		c.output(stream, line)
+	}
+}
+
+func (c *outputCollector) tail() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return string(c.buf)
+}
+
+type lineWriter struct {
+	stream  string
+	out     *outputCollector
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.out.line(w.stream, strings.TrimSuffix(string(w.partial[:i]), "\r"))
+		w.partial = w.partial[i+1:]
+	}
+
+	return len(p), nil
+}
+
+func (w *lineWriter) flush() {
+	if len(w.partial) > 0 {
+		w.out.line(w.stream, string(w.partial))
+		w.partial = nil
+	}
+}
@@ -0,0 +1,314 @@
+//go:build linux
+
+package runner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// sandboxInit is the name the sandbox's init process runs under. The init
+// process is this binary again: it sets up the sandbox's mounts, drops its
+// privileges and replaces itself with the command.
+const sandboxInit = "runner-sandbox-init"
+
+func init() {
+	if len(os.Args) > 0 && os.Args[0] == sandboxInit {
+		if err := enterSandbox(os.Args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+		}
+		os.Exit(126)
+	}
+}
+
+// prctl options missing from package syscall.
+const (
+	prCapBSetDrop    = 24
+	prSetNoNewPrivs  = 38
+	defaultLastCap   = 40
+	capLastCapSysctl = "/proc/sys/kernel/cap_last_cap"
+)
+
+// sandbox starts the command through the sandbox's init process, in fresh
+// PID, IPC, UTS, mount and (unless allowed) network namespaces. As root
+// the init process switches to the configured user; otherwise a user
+// namespace maps root onto our user and the init process gives up every
+// capability. Only the writable directories can be written to.
+func sandbox(cmd *exec.Cmd, limits Limits, writable ...string) error {
+	flags := syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS | syscall.CLONE_NEWNS
+	if !limits.Network {
+		flags |= syscall.CLONE_NEWNET
+	}
+
+	attr := &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
+	}
+
+	// The init process needs root, in some namespace, to mount.
+	uid, gid := limits.UID, limits.GID
+	if os.Geteuid() != 0 {
+		flags |= syscall.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+		uid, gid = -1, -1
+	}
+
+	attr.Cloneflags = uintptr(flags)
+	cmd.SysProcAttr = attr
+
+	args := []string{sandboxInit, strconv.Itoa(uid), strconv.Itoa(gid), strconv.Itoa(len(writable))}
+	for _, p := range writable {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		args = append(args, abs)
+	}
+	args = append(args, cmd.Path)
+	args = append(args, cmd.Args[1:]...)
+
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = args
+
+	// The command is PID 1 of its namespace, so killing it takes down
+	// everything it started.
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	return nil
+}
+
+// enterSandbox runs in the init process. args are the user and group to
+// switch to (-1 to stay), the number of writable directories, the
+// directories and the command.
+func enterSandbox(args []string) error {
+	// Capability bounding sets and no_new_privs are per thread; they must
+	// be set on the thread that execs.
+	runtime.LockOSThread()
+
+	if len(args) < 3 {
+		return errors.New("missing arguments")
+	}
+	uid, errUID := strconv.Atoi(args[0])
+	gid, errGID := strconv.Atoi(args[1])
+	n, errN := strconv.Atoi(args[2])
+	if err := errors.Join(errUID, errGID, errN); err != nil || n < 0 || len(args) < 3+n+1 {
+		return fmt.Errorf("invalid arguments %q", args)
+	}
+	writable, command := args[3:3+n], args[3+n:]
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	if err := isolateMounts(writable); err != nil {
+		return err
+	}
+
+	// The working directory was entered before its writable mount
+	// covered it.
+	if err := os.Chdir(wd); err != nil {
+		return err
+	}
+
+	if err := dropPrivileges(uid, gid); err != nil {
+		return err
+	}
+
+	return syscall.Exec(command[0], command, os.Environ())
+}
+
+// isolateMounts makes every mount read-only except the writable
+// directories, and mounts a /proc showing only the sandbox's processes.
+// The mount namespace is made private first so none of it reaches the
+// host.
+func isolateMounts(writable []string) error {
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("making mounts private: %w", err)
+	}
+
+	// Bind mounts of the writable directories keep them writable when
+	// the mounts they live on turn read-only.
+	for _, p := range writable {
+		if err := syscall.Mount(p, p, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return fmt.Errorf("mounting %s: %w", p, err)
+		}
+	}
+
+	points, err := mountPoints()
+	if err != nil {
+		return err
+	}
+	for _, p := range points {
+		if below(p, writable) {
+			continue
+		}
+		if err := remountReadOnly(p); err != nil {
+			return fmt.Errorf("making %s read-only: %w", p, err)
+		}
+	}
+
+	if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mounting /proc: %w", err)
+	}
+
+	return nil
+}
+
+// mountPoints lists the mount points of the mount namespace, parents
+// before children.
+func mountPoints() ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var points []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		points = append(points, unescapeMountPath(fields[4]))
+	}
+	return points, scanner.Err()
+}
+
+// unescapeMountPath decodes the octal escapes of spaces, tabs, newlines
+// and backslashes in mountinfo paths.
+func unescapeMountPath(p string) string {
+	if !strings.Contains(p, `\`) {
+		return p
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] == '\\' && i+3 < len(p) {
+			if c, err := strconv.ParseUint(p[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(p[i])
+	}
+	return b.String()
+}
+
+// below reports whether p is one of dirs or inside one of them.
+func below(p string, dirs []string) bool {
+	for _, dir := range dirs {
+		if p == dir || strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// keptFlags are the statfs flags of a mount with the mount flags that keep
+// them on remount. User namespaces may not clear them.
+var keptFlags = []struct{ st, ms uintptr }{
+	{0x2, syscall.MS_NOSUID},
+	{0x4, syscall.MS_NODEV},
+	{0x8, syscall.MS_NOEXEC},
+	{0x400, syscall.MS_NOATIME},
+	{0x800, syscall.MS_NODIRATIME},
+	{0x1000, syscall.MS_RELATIME},
+}
+
+func remountReadOnly(p string) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(p, &st); err != nil {
+		// Mount points hidden by later mounts can't be reached.
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+	for _, f := range keptFlags {
+		if uintptr(st.Flags)&f.st != 0 {
+			flags |= f.ms
+		}
+	}
+
+	return syscall.Mount("", p, "", flags, "")
+}
+
+// dropPrivileges switches to uid and gid, or, when they are -1, empties the
+// capability bounding set so root of the user namespace execs without
+// capabilities. Either way setuid binaries grant nothing afterwards.
+func dropPrivileges(uid, gid int) error {
+	if uid >= 0 {
+		if err := syscall.Setgroups(nil); err != nil {
+			return fmt.Errorf("dropping groups: %w", err)
+		}
+		if err := syscall.Setgid(gid); err != nil {
+			return fmt.Errorf("switching group: %w", err)
+		}
+		if err := syscall.Setuid(uid); err != nil {
+			return fmt.Errorf("switching user: %w", err)
+		}
+	} else {
+		for c := 0; c <= lastCap(); c++ {
+			if err := prctl(prCapBSetDrop, uintptr(c)); err != nil && !errors.Is(err, syscall.EINVAL) {
+				return fmt.Errorf("dropping capability %d: %w", c, err)
+			}
+		}
+	}
+
+	if err := prctl(prSetNoNewPrivs, 1); err != nil {
+		return fmt.Errorf("setting no_new_privs: %w", err)
+	}
+	return nil
+}
+
+// lastCap returns the highest capability the kernel knows.
+func lastCap() int {
+	b, err := os.ReadFile(capLastCapSysctl)
+	if err != nil {
+		return defaultLastCap
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return defaultLastCap
+	}
+	return n
+}
+
+func prctl(option, arg uintptr) error {
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, option, arg, 0, 0, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// grantAccess hands the tree at root to the sandbox user. Without root the
+// user namespace mapping already makes our files theirs.
+func grantAccess(root string, limits Limits) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(p, limits.UID, limits.GID)
+	})
+}
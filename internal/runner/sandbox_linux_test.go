@@ -0,0 +1,59 @@
+//go:build linux
+
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSandboxWritableDirs(t *testing.T) {
+	dir := t.TempDir()
+
+	// Anyone may write to outside, so only the sandbox's mounts stop it.
+	outside, err := os.MkdirTemp("", "runner-outside-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	if err := os.Chmod(outside, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		passed  bool
+		output  string
+	}{
+		{name: "project", command: "echo ok > built && cat built", passed: true, output: "ok"},
+		{name: "home", command: `echo ok > "$HOME/cache" && cat "$HOME/cache"`, passed: true, output: "ok"},
+		{name: "outside", command: "echo leak > " + filepath.Join(outside, "leak"), output: "Read-only file system"},
+		{name: "pid namespace", command: "echo pid $$ && test -d /proc/1", passed: true, output: "pid 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps := []Step{{Stage: "test", Command: tt.command}}
+			result, err := Run(context.Background(), dir, steps, DefaultLimits, nil)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			step := result.Steps[0]
+			if result.Passed != tt.passed {
+				t.Fatalf("passed = %v, want %v (exit %d: %s%s)", result.Passed, tt.passed, step.ExitCode, step.Output, step.Error)
+			}
+			if !strings.Contains(step.Output, tt.output) {
+				t.Errorf("output = %q, want it to contain %q", step.Output, tt.output)
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "leak")); !os.IsNotExist(err) {
+		t.Errorf("sandbox wrote outside its directories: %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package runner
+
+import "os/exec"
+
+// sandbox relies on Linux namespaces; other platforms refuse to run
+// generated code rather than run it unrestricted.
+func sandbox(cmd *exec.Cmd, limits Limits, writable ...string) error {
+	return ErrUnsupported
+}
+
+func grantAccess(root string, limits Limits) error {
+	return nil
+}
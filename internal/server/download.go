@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/agents"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/apierror"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/archive"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/storage"
+)
+
+var errProjectNotReady = errors.New("project not found or not ready for download")
+
+// project finds the stored project of a session. It returns the key prefix
+// of the project's files, ending in a slash, and every stored object below
+// it.
+func (s *Server) project(ctx context.Context, sessionID string) (string, []storage.Object, error) {
+	if sessionID == "" || sessionID != filepath.Base(sessionID) || strings.HasPrefix(sessionID, ".") {
+		return "", nil, errProjectNotReady
+	}
+
+	objects, err := s.generations.store.List(ctx, sessionID+"/")
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Sessions hold a single project directory.
+	for _, obj := range objects {
+		rest := strings.TrimPrefix(obj.Key, sessionID+"/")
+		if name, _, ok := strings.Cut(rest, "/"); ok {
+			prefix := sessionID + "/" + name + "/"
+
+			var files []storage.Object
+			for _, o := range objects {
+				if strings.HasPrefix(o.Key, prefix) {
+					o.Key = strings.TrimPrefix(o.Key, prefix)
+					files = append(files, o)
+				}
+			}
+			return prefix, files, nil
+		}
+	}
+
+	return "", nil, errProjectNotReady
+}
+
+// projectFiles lists the files recorded in a project's manifest, along with
+// the manifest itself. Projects without a manifest are still being
+// generated or were blocked, and can't be downloaded. Files the sandbox
+// created while running the project are left out.
+func (s *Server) projectFiles(ctx context.Context, prefix string) ([]string, error) {
+	body, _, err := s.generations.store.Get(ctx, prefix+agents.ManifestPath)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, errProjectNotReady
+		}
+		return nil, err
+	}
+	defer body.Close()
+
+	var m agents.Manifest
+	if err := json.NewDecoder(body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	return m.Paths(), nil
+}
+
+// selectFiles keeps the files at or below sub.
+func selectFiles(files []string, sub string) []string {
+	if sub == "" {
+		return files
+	}
+
+	var selected []string
+	for _, f := range files {
+		if f == sub || strings.HasPrefix(f, sub+"/") {
+			selected = append(selected, f)
+		}
+	}
+	return selected
+}
+
+// cleanSubPath validates the path query parameter, which must stay inside
+// the project.
+func cleanSubPath(p string) (string, error) {
+	if p == "" {
+		return "", nil
+	}
+
+	cleaned := path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))[1:]
+	if cleaned != strings.Trim(p, "/") {
+		return "", fmt.Errorf("invalid path %q", p)
+	}
+	return cleaned, nil
+}
+
+// HandleDownload streams a generated project of the signed in user as an
+// archive. The format query parameter picks zip (the default), tar.gz or
+// tar.zst, and path restricts the download to one file or directory. A
+// single file requested without a format is sent as is.
+func (s *Server) HandleDownload(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("id")
+	ctx := r.Context()
+
+	if !s.authorizeSession(w, r, sessionID) {
+		return
+	}
+
+	prefix, _, err := s.project(ctx, sessionID)
+	if err != nil {
+		if !errors.Is(err, errProjectNotReady) {
+			log.Printf("Error finding project of session %s: %v", sessionID, err)
+		}
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "Session not found")
+		return
+	}
+
+	files, err := s.projectFiles(ctx, prefix)
+	if err != nil {
+		log.Printf("Error listing files of session %s: %v", sessionID, err)
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "Project not found")
+		return
+	}
+
+	query := r.URL.Query()
+
+	sub, err := cleanSubPath(query.Get("path"))
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+		return
+	}
+
+	files = selectFiles(files, sub)
+	if len(files) == 0 {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "Path not found")
+		return
+	}
+
+	if len(files) == 1 && files[0] == sub && query.Get("format") == "" {
+		s.serveFile(w, r, prefix, sub)
+		return
+	}
+
+	format, err := archive.ParseFormat(query.Get("format"))
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+		return
+	}
+
+	name := path.Base(strings.TrimSuffix(prefix, "/"))
+	if sub != "" {
+		name += "-" + path.Base(sub)
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+archive.Extension(format)))
+	w.Header().Set("Content-Type", archive.ContentType(format))
+
+	// The status is sent with the first write, so errors past this point
+	// can only be logged; the client sees a truncated archive.
+	if err := archive.Write(w, format, storage.FS(ctx, s.generations.store, prefix), files); err != nil {
+		log.Printf("Error streaming %s archive of session %s: %v", format, sessionID, err)
+	}
+}
+
+// serveFile sends a single stored file as an attachment.
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, prefix, name string) {
+	body, obj, err := s.generations.store.Get(r.Context(), prefix+name)
+	if err != nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "Path not found")
+		return
+	}
+	defer body.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(name)))
+	w.Header().Set("Content-Type", contentType)
+	if obj.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	}
+
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("Error sending %s: %v", prefix+name, err)
+	}
+}
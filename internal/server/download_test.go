@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/agents"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/data"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/token"
+)
+
+func TestDownloadRequiresOwner(t *testing.T) {
+	codegens := newMemCodeGens()
+	srv := NewServer("test-key", t.TempDir(), codegens)
+
+	if err := codegens.Create(&data.CodenGen{SessionID: "s1", UserID: 1, Status: data.StatusComplete}); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, _ := json.Marshal(agents.Manifest{Files: []agents.ManifestFile{{Path: "main.go"}}})
+	ctx := context.Background()
+	for key, content := range map[string]string{
+		"s1/app/main.go":                "package main\n",
+		"s1/app/" + agents.ManifestPath: string(manifest),
+	} {
+		if err := srv.generations.store.Put(ctx, key, strings.NewReader(content), -1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		user   *data.User
+		status int
+	}{
+		{name: "owner", user: &data.User{ID: "1"}, status: http.StatusOK},
+		{name: "other user", user: &data.User{ID: "2"}, status: http.StatusForbidden},
+		{name: "signed out", status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/download/s1?path=main.go", nil)
+			r.SetPathValue("id", "s1")
+			if tt.user != nil {
+				r = token.ContextSetUser(r, tt.user)
+			}
+			w := httptest.NewRecorder()
+
+			srv.HandleDownload(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusOK && w.Body.String() != "package main\n" {
+				t.Errorf("body = %q, want main.go", w.Body)
+			}
+		})
+	}
+}
+
+func TestHistoryListsOwnGenerations(t *testing.T) {
+	codegens := newMemCodeGens()
+	srv := NewServer("test-key", t.TempDir(), codegens)
+
+	for _, cg := range []*data.CodenGen{
+		{SessionID: "mine", UserID: 1},
+		{SessionID: "theirs", UserID: 2},
+	} {
+		if err := codegens.Create(cg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The user_id parameter is ignored.
+	r := httptest.NewRequest(http.MethodGet, "/api/history?user_id=2", nil)
+	w := httptest.NewRecorder()
+	srv.HandleGetUserHistory(w, token.ContextSetUser(r, &data.User{ID: "1"}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var history []data.CodenGen
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].SessionID != "mine" {
+		t.Errorf("history = %+v, want only session mine", history)
+	}
+
+	w = httptest.NewRecorder()
+	srv.HandleGetUserHistory(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("signed out status = %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// interruptGrace is how long cancelled generations get to record their end
+// before their sessions are marked interrupted directly.
+const interruptGrace = 5 * time.Second
+
+var (
+	errDraining  = errors.New("the server is shutting down and doesn't accept new generations")
+	errShutdown  = errors.New("server shut down")
+	errCancelled = errors.New("generation cancelled")
+)
+
+// begin registers a starting generation. It reports false once the service
+// is draining.
+func (g *GenerationService) begin() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.draining {
+		return false
+	}
+	g.wg.Add(1)
+	return true
+}
+
+// track makes a running generation cancellable by Drain.
+func (g *GenerationService) track(sessionID string, cancel context.CancelCauseFunc) func() {
+	g.mutex.Lock()
+	g.running[sessionID] = cancel
+	g.mutex.Unlock()
+
+	return func() {
+		g.mutex.Lock()
+		delete(g.running, sessionID)
+		g.mutex.Unlock()
+	}
+}
+
+// interrupted reports whether a generation was cancelled by Drain.
+func interrupted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errShutdown)
+}
+
+// cancelled reports whether a generation was cancelled by Cancel.
+func cancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errCancelled)
+}
+
+// Cancel stops the generation of a session running on this server. It
+// reports false when there is none.
+func (g *GenerationService) Cancel(sessionID string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	cancel, ok := g.running[sessionID]
+	if ok {
+		cancel(errCancelled)
+	}
+	return ok
+}
+
+// Running reports whether the generation of a session is running on this
+// server.
+func (g *GenerationService) Running(sessionID string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	_, ok := g.running[sessionID]
+	return ok
+}
+
+// Running reports whether the generation of a session is running on this
+// server.
+func (s *Server) Running(sessionID string) bool {
+	return s.generations.Running(sessionID)
+}
+
+// Draining reports whether the service stopped accepting generations.
+func (g *GenerationService) Draining() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.draining
+}
+
+func (g *GenerationService) stopAccepting() {
+	g.mutex.Lock()
+	g.draining = true
+	g.mutex.Unlock()
+}
+
+// Drain stops the service from starting generations and waits for the
+// running ones until ctx is done. Generations still running then are
+// cancelled and their sessions marked interrupted.
+func (g *GenerationService) Drain(ctx context.Context) error {
+	g.stopAccepting()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	g.mutex.Lock()
+	sessionIDs := make([]string, 0, len(g.running))
+	for sessionID, cancel := range g.running {
+		sessionIDs = append(sessionIDs, sessionID)
+		cancel(errShutdown)
+	}
+	g.mutex.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(interruptGrace):
+	}
+
+	if g.codegens != nil {
+		if _, err := g.codegens.MarkInterrupted(sessionIDs); err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("interrupted %d running generations: %w", len(sessionIDs), ctx.Err())
+}
+
+// Drain refuses new generations, tells connected WebSocket clients that the
+// server is shutting down and waits for the running generations as
+// GenerationService.Drain does.
+func (s *Server) Drain(ctx context.Context) error {
+	s.generations.stopAccepting()
+
+	s.clientsMutex.Lock()
+	for client := range s.clients {
+		sendEvent(client, drainingEvent())
+	}
+	log.Printf("Draining: told %d connected clients", len(s.clients))
+	s.clientsMutex.Unlock()
+
+	return s.generations.Drain(ctx)
+}
+
+func drainingEvent() ProgressEvent {
+	return ProgressEvent{
+		Type:    EventDraining,
+		Message: "The server is shutting down: running generations are finished, new ones are refused",
+	}
+}
+
+// addClient registers a connected WebSocket client, telling it right away
+// when the server is already draining. Call the returned function when it
+// disconnects.
+func (s *Server) addClient(client *WebSocketClient) func() {
+	s.clientsMutex.Lock()
+	s.clients[client] = struct{}{}
+	s.clientsMutex.Unlock()
+
+	if s.generations.Draining() {
+		sendEvent(client, drainingEvent())
+	}
+
+	return func() {
+		s.clientsMutex.Lock()
+		delete(s.clients, client)
+		s.clientsMutex.Unlock()
+	}
+}
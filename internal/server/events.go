@@ -0,0 +1,338 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/data"
+)
+
+const (
+	// subscriberBuffer is how many events a resumed client may fall behind
+	// before it is dropped and has to catch up from the database.
+	subscriberBuffer = 256
+
+	// pollInterval is how often the database is checked for new events of
+	// generations running on another server.
+	pollInterval = time.Second
+)
+
+var (
+	errNoUser         = errors.New("not authenticated")
+	errSessionDenied  = errors.New("you do not have access to this session")
+	errBadLastEventID = errors.New("lastEventId must be a non-negative integer")
+)
+
+// eventHub keeps the event streams of the generations running on this
+// server, so resumed clients can follow them live.
+type eventHub struct {
+	mutex   sync.Mutex
+	streams map[string]*eventStream
+}
+
+// eventStream numbers, stores and fans out the events of one session.
+type eventStream struct {
+	sessionID   string
+	mutex       sync.Mutex
+	lastID      int64
+	subscribers map[chan ProgressEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{streams: make(map[string]*eventStream)}
+}
+
+// open starts the event stream of a session.
+func (h *eventHub) open(sessionID string) *eventStream {
+	stream := &eventStream{
+		sessionID:   sessionID,
+		subscribers: make(map[chan ProgressEvent]struct{}),
+	}
+
+	h.mutex.Lock()
+	h.streams[sessionID] = stream
+	h.mutex.Unlock()
+
+	return stream
+}
+
+// close ends a stream, closing the channels of its subscribers.
+func (h *eventHub) close(stream *eventStream) {
+	h.mutex.Lock()
+	delete(h.streams, stream.sessionID)
+	h.mutex.Unlock()
+
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	for ch := range stream.subscribers {
+		close(ch)
+		delete(stream.subscribers, ch)
+	}
+}
+
+// subscribe follows the live events of a session. The channel is nil when
+// the session isn't running on this server. Call the returned function to
+// stop following.
+func (h *eventHub) subscribe(sessionID string) (<-chan ProgressEvent, func()) {
+	h.mutex.Lock()
+	stream, ok := h.streams[sessionID]
+	h.mutex.Unlock()
+	if !ok {
+		return nil, func() {}
+	}
+
+	ch := make(chan ProgressEvent, subscriberBuffer)
+	stream.mutex.Lock()
+	stream.subscribers[ch] = struct{}{}
+	stream.mutex.Unlock()
+
+	return ch, func() {
+		stream.mutex.Lock()
+		defer stream.mutex.Unlock()
+		if _, ok := stream.subscribers[ch]; ok {
+			close(ch)
+			delete(stream.subscribers, ch)
+		}
+	}
+}
+
+// record numbers an event of a session, stores it and hands it to the
+// clients following the session. It returns the numbered event.
+func (g *GenerationService) record(stream *eventStream, event ProgressEvent) ProgressEvent {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	stream.lastID++
+	event.ID = stream.lastID
+	event.Version, event.Seq = 0, 0
+
+	payload, err := json.Marshal(event)
+	if err == nil {
+		err = g.codegens.AppendEvent(&data.Event{
+			SessionID: stream.sessionID,
+			Seq:       event.ID,
+			Type:      event.Type,
+			Payload:   payload,
+		})
+	}
+	if err != nil {
+		log.Printf("Error recording event of session %s: %v", stream.sessionID, err)
+	}
+
+	for ch := range stream.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Too slow; the client catches up from the database.
+			close(ch)
+			delete(stream.subscribers, ch)
+		}
+	}
+
+	return event
+}
+
+// finalEvent reports whether event is the last one of a generation.
+func finalEvent(event ProgressEvent) bool {
+	return event.Type == EventComplete || event.Type == EventError
+}
+
+// replay sends the events of a session after lastEventID to emit, then
+// follows the generation until it ends, ctx is done or emit fails.
+func (s *Server) replay(ctx context.Context, sessionID string, lastEventID int64, emit func(ProgressEvent) error) error {
+	// Subscribe before reading the database so no event falls in between;
+	// the overlap is skipped by ID.
+	live, unsubscribe := s.generations.events.subscribe(sessionID)
+	defer unsubscribe()
+
+	lastEventID, done, err := s.replayStored(sessionID, lastEventID, emit)
+	if err != nil || done {
+		return err
+	}
+
+	if live == nil {
+		return s.pollEvents(ctx, sessionID, lastEventID, emit)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-live:
+			if !ok {
+				// Dropped for being slow, or the generation stopped
+				// without a final event; start over from the database.
+				unsubscribe()
+				return s.replay(ctx, sessionID, lastEventID, emit)
+			}
+			if event.ID <= lastEventID {
+				continue
+			}
+			if err := emit(event); err != nil {
+				return err
+			}
+			lastEventID = event.ID
+			if finalEvent(event) {
+				return nil
+			}
+		}
+	}
+}
+
+// replayStored sends the stored events after lastEventID. It returns the ID
+// of the last event sent and whether it ended the generation.
+func (s *Server) replayStored(sessionID string, lastEventID int64, emit func(ProgressEvent) error) (int64, bool, error) {
+	stored, err := s.codegenModel.EventsAfter(sessionID, lastEventID)
+	if err != nil {
+		return lastEventID, false, err
+	}
+
+	for _, e := range stored {
+		var event ProgressEvent
+		if err := json.Unmarshal(e.Payload, &event); err != nil {
+			return lastEventID, false, fmt.Errorf("decoding event %d of session %s: %w", e.Seq, sessionID, err)
+		}
+		if err := emit(event); err != nil {
+			return lastEventID, false, err
+		}
+		lastEventID = event.ID
+		if finalEvent(event) {
+			return lastEventID, true, nil
+		}
+	}
+
+	return lastEventID, false, nil
+}
+
+// pollEvents follows a generation running on another server through the
+// database. It stops once the generation has stopped running and no new
+// events turned up for a whole interval.
+func (s *Server) pollEvents(ctx context.Context, sessionID string, lastEventID int64, emit func(ProgressEvent) error) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	stopped := false
+	for {
+		record, err := s.codegenModel.GetBySessionID(sessionID)
+		if err != nil {
+			return err
+		}
+
+		last, done, err := s.replayStored(sessionID, lastEventID, emit)
+		if err != nil || done {
+			return err
+		}
+
+		idle := last == lastEventID
+		lastEventID = last
+
+		if record.Status != data.StatusRunning {
+			if stopped && idle {
+				return nil
+			}
+			stopped = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkSessionOwner returns nil when the session belongs to user.
+func (s *Server) checkSessionOwner(user *data.User, sessionID string) error {
+	if user == nil {
+		return errNoUser
+	}
+
+	record, err := s.codegenModel.GetBySessionID(sessionID)
+	if err != nil {
+		return err
+	}
+
+	if strconv.Itoa(record.UserID) != user.ID {
+		return errSessionDenied
+	}
+
+	return nil
+}
+
+// parseLastEventID reads the ID of the last event a client saw.
+func parseLastEventID(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, errBadLastEventID
+	}
+	return id, nil
+}
+
+// resume replays the events of a session the client owns over its
+// WebSocket.
+func (s *Server) resume(ctx context.Context, wsClient *WebSocketClient, user *data.User, msg ClientMessage) {
+	send := func(event ProgressEvent) {
+		event.RequestID = msg.RequestID
+		sendEvent(wsClient, event)
+	}
+
+	if err := s.checkSessionOwner(user, msg.SessionID); err != nil {
+		send(sessionErrorEvent(msg.SessionID, err))
+		return
+	}
+
+	err := s.replay(ctx, msg.SessionID, msg.LastEventID, func(event ProgressEvent) error {
+		send(event)
+		return nil
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("Error replaying events of session %s: %v", msg.SessionID, err)
+		send(errorEvent(CodeInternal, "Failed to replay events"))
+	}
+}
+
+// cancelGeneration cancels the running generation of a session the client
+// owns. The generation reports the cancellation with its final event.
+func (s *Server) cancelGeneration(wsClient *WebSocketClient, user *data.User, msg ClientMessage) {
+	send := func(event ProgressEvent) {
+		event.RequestID = msg.RequestID
+		sendEvent(wsClient, event)
+	}
+
+	if msg.SessionID == "" {
+		send(errorEvent(CodeBadRequest, "Cancel message without a sessionId"))
+		return
+	}
+
+	if err := s.checkSessionOwner(user, msg.SessionID); err != nil {
+		send(sessionErrorEvent(msg.SessionID, err))
+		return
+	}
+
+	if !s.generations.Cancel(msg.SessionID) {
+		send(errorEvent(CodeNotFound, "The session has no generation running on this server"))
+	}
+}
+
+// sessionErrorEvent reports a failed checkSessionOwner.
+func sessionErrorEvent(sessionID string, err error) ProgressEvent {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return errorEvent(CodeNotFound, "Session not found")
+	case errors.Is(err, errNoUser), errors.Is(err, errSessionDenied):
+		return errorEvent(CodeForbidden, errSessionDenied.Error())
+	default:
+		log.Printf("Error loading session %s: %v", sessionID, err)
+		return errorEvent(CodeInternal, "Failed to load session")
+	}
+}
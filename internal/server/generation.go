@@ -0,0 +1,444 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/agents"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/data"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/guard"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/runner"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/storage"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/validator"
+)
+
+const blockedMessage = "The generated project contains hard-coded secrets or dangerous commands, so no download was created"
+
+// EventSink receives the progress events of a generation. Run calls Send
+// from one goroutine at a time, in the order the events were recorded.
+type EventSink interface {
+	Send(event ProgressEvent)
+}
+
+// SinkFunc adapts a function to an EventSink.
+type SinkFunc func(event ProgressEvent)
+
+func (f SinkFunc) Send(event ProgressEvent) {
+	f(event)
+}
+
+// GenerationError is returned by Run when a generation fails. Code is one of
+// the error event codes; Errors holds the field errors of requests failing
+// validation.
+type GenerationError struct {
+	Code    string
+	Message string
+	Errors  map[string]string
+}
+
+func (e *GenerationError) Error() string {
+	return e.Message
+}
+
+// Generation describes a generation run by the GenerationService.
+type Generation struct {
+	SessionID   string
+	ProjectName string
+	// ProjectDir is the directory the project was written to. It is gone
+	// after Run when the project was copied to a remote artifact store.
+	ProjectDir string
+	// Status is one of the data.Status values.
+	Status string
+
+	Result   *agents.GenerationResult
+	Manifest *agents.Manifest
+	Run      *runner.Result
+	// Contents maps the paths of the generated files to their contents in
+	// dry runs.
+	Contents map[string]string
+
+	// DownloadURL is set once the project is stored and can be downloaded.
+	DownloadURL string
+}
+
+// CodeGenStore records generations and their events. *data.CodeGenModel
+// implements it.
+type CodeGenStore interface {
+	Create(cg *data.CodenGen) error
+	UpdateStatus(cg *data.CodenGen) error
+	GetBySessionID(sessionID string) (*data.CodenGen, error)
+	GetAllByUserID(userID int) ([]*data.CodenGen, error)
+	MarkInterrupted(sessionIDs []string) (int64, error)
+	AppendEvent(e *data.Event) error
+	EventsAfter(sessionID string, after int64) ([]data.Event, error)
+}
+
+// GenerationService runs generations the same way for every transport: it
+// validates the request, records the session and its events, generates the
+// project, stores it and optionally runs it.
+type GenerationService struct {
+	openAIKey  string
+	outputBase string
+	httpClient *http.Client
+
+	// codegens is nil when generations aren't recorded, as in the CLI.
+	codegens    CodeGenStore
+	events      *eventHub
+	store       storage.ArtifactStore
+	runLimits   runner.Limits
+	blockUnsafe bool
+	version     string
+
+	// mutex guards draining and running, the cancel functions of the
+	// running generations by session ID. wg counts them.
+	mutex    sync.Mutex
+	draining bool
+	running  map[string]context.CancelCauseFunc
+	wg       sync.WaitGroup
+}
+
+// NewGenerationService returns a service generating projects below
+// outputBase and recording them with codegens, which may be nil.
+func NewGenerationService(openAIKey, outputBase string, codegens CodeGenStore) *GenerationService {
+	return &GenerationService{
+		openAIKey:  openAIKey,
+		outputBase: outputBase,
+		httpClient: &http.Client{
+			Timeout: 1000 * time.Second,
+			Transport: &http.Transport{
+				MaxIdleConns:          100,
+				ResponseHeaderTimeout: 1000 * time.Second,
+				MaxIdleConnsPerHost:   100,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				DisableCompression:    false,
+				ExpectContinueTimeout: 5 * time.Second,
+				DialContext: (&net.Dialer{
+					Timeout:   1000 * time.Second,
+					KeepAlive: 1000 * time.Second,
+				}).DialContext,
+			},
+		},
+		codegens:  codegens,
+		events:    newEventHub(),
+		runLimits: runner.DefaultLimits,
+		running:   make(map[string]context.CancelCauseFunc),
+	}
+}
+
+// SetVersion sets the generator version recorded in project manifests.
+func (g *GenerationService) SetVersion(version string) {
+	g.version = version
+}
+
+// SetHTTPClient sets the client model requests are sent with.
+func (g *GenerationService) SetHTTPClient(client *http.Client) {
+	g.httpClient = client
+}
+
+// Run generates the project described by req, sending its progress to sink.
+//
+// Requests that fail validation return a nil Generation and a
+// GenerationError without sending any event. From the start event on, Run
+// ends with exactly one complete or error event and returns the Generation
+// even when it fails.
+func (g *GenerationService) Run(ctx context.Context, req ProjectRequest, sink EventSink) (*Generation, error) {
+	if sink == nil {
+		sink = SinkFunc(func(ProgressEvent) {})
+	}
+
+	if !g.begin() {
+		return nil, &GenerationError{Code: CodeUnavailable, Message: errDraining.Error()}
+	}
+	defer g.wg.Done()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var userID int
+	if g.codegens != nil {
+		id, err := strconv.Atoi(req.ID)
+		if err != nil {
+			return nil, &GenerationError{Code: CodeBadRequest, Message: "Invalid user ID format: " + err.Error()}
+		}
+		if id == 0 {
+			return nil, &GenerationError{Code: CodeBadRequest, Message: "User ID is required"}
+		}
+		userID = id
+	}
+
+	if req.WorkerCount == 0 {
+		req.WorkerCount = defaultWorkerCount
+	}
+
+	sampling, err := json.Marshal(req.Sampling)
+	if err != nil {
+		return nil, &GenerationError{Code: CodeBadRequest, Message: "Invalid sampling parameters: " + err.Error()}
+	}
+
+	gen := &Generation{
+		SessionID:   uuid.New().String(),
+		ProjectName: req.ProjectName,
+		ProjectDir:  req.OutputDir,
+		Status:      data.StatusRunning,
+	}
+	if gen.ProjectName == "" {
+		gen.ProjectName = fmt.Sprintf("%s-project", req.Language)
+	}
+
+	// Until the session is recorded, events only go to the sink. Planned
+	// units report from worker goroutines, so sending is serialized.
+	var stream *eventStream
+	var sendMutex sync.Mutex
+	send := func(event ProgressEvent) {
+		sendMutex.Lock()
+		defer sendMutex.Unlock()
+
+		if stream != nil {
+			event = g.record(stream, event)
+		}
+		sink.Send(event)
+	}
+
+	progressCallback := func(eventType, message, file string) {
+		event := agentEvent(eventType, message, file)
+		if event.Type == EventFile {
+			event.ProjectDir = gen.ProjectName
+		}
+		send(event)
+	}
+
+	sessionDir := filepath.Join(g.outputBase, gen.SessionID)
+	if gen.ProjectDir == "" {
+		gen.ProjectDir = filepath.Join(sessionDir, gen.ProjectName)
+	}
+
+	client := agents.NewOpenAI(ctx, g.openAIKey, req.Model, g.httpClient)
+	agent, err := agents.NewAgentWithCallback(
+		ctx, client, gen.ProjectDir, req.BasePackage,
+		req.Template, req.Language, req.WorkerCount,
+		progressCallback,
+	)
+	if err != nil {
+		return nil, &GenerationError{Code: CodeBadRequest, Message: "Failed to initialize agent: " + err.Error()}
+	}
+
+	// Nothing is written before the request is known to be valid.
+	v := validator.New()
+	if ValidateProjectRequest(v, &req, agent.ListTemplates()); !v.Valid() {
+		return nil, validationError(v.Errors)
+	}
+
+	projectContext := req.Context
+	if projectContext == nil {
+		if projectContext, err = req.projectContext(); err != nil {
+			return nil, &GenerationError{Code: CodeBadRequest, Message: "Failed to load project context: " + err.Error()}
+		}
+	}
+	agent.SetProjectContext(projectContext)
+	agent.SetAutoFix(!req.NoAutoFix)
+	agent.SetDryRun(req.DryRun)
+	agent.SetPlanning(req.Plan)
+	agent.SetRepairRounds(req.RepairRounds)
+	agent.SetWithTests(req.WithTests)
+	if err := agent.SetProtocol(req.Protocol); err != nil {
+		return nil, &GenerationError{Code: CodeBadRequest, Message: err.Error()}
+	}
+	if err := agent.SetSampling(req.Sampling); err != nil {
+		return nil, &GenerationError{Code: CodeBadRequest, Message: err.Error()}
+	}
+	if err := agent.SetLicense(req.License, req.LicenseHolder); err != nil {
+		return nil, &GenerationError{Code: CodeBadRequest, Message: err.Error()}
+	}
+
+	// Projects written to a directory of the caller's choosing stay there.
+	if req.OutputDir == "" && !req.DryRun {
+		if err := os.MkdirAll(gen.ProjectDir, 0755); err != nil {
+			return nil, &GenerationError{Code: CodeInternal, Message: "Failed to create project directory: " + err.Error()}
+		}
+		defer g.releaseWorkDir(sessionDir)
+	}
+
+	var record *data.CodenGen
+	if g.codegens != nil {
+		// Secrets in the prompt are kept out of the database as they are
+		// kept from the model.
+		prompt, _ := guard.RedactPrompt(req.Prompt)
+		record = &data.CodenGen{
+			UserID:      userID,
+			Language:    req.Language,
+			Template:    req.Template,
+			BasePackage: req.BasePackage,
+			Workers:     req.WorkerCount,
+			Model:       req.Model,
+			ProjectName: gen.ProjectName,
+			Prompt:      prompt,
+			SessionID:   gen.SessionID,
+			Sampling:    sampling,
+		}
+		if err := g.codegens.Create(record); err != nil {
+			return nil, &GenerationError{Code: CodeInternal, Message: "Failed to save generation request: " + err.Error()}
+		}
+
+		stream = g.events.open(gen.SessionID)
+		defer g.events.close(stream)
+	}
+	defer g.track(gen.SessionID, cancel)()
+
+	// finish records the outcome of the generation.
+	finish := func(status string) {
+		gen.Status = status
+		if record == nil {
+			return
+		}
+
+		record.Status = status
+		record.Protocol = agent.Protocol()
+		record.Sampling, _ = json.Marshal(agent.Sampling())
+		if err := g.codegens.UpdateStatus(record); err != nil {
+			log.Printf("Error updating generation status: %v", err)
+		}
+	}
+
+	fail := func(status string, event ProgressEvent) (*Generation, error) {
+		switch {
+		case interrupted(ctx):
+			status = data.StatusInterrupted
+			event = errorEvent(CodeInterrupted, "The server shut down before the generation finished")
+		case cancelled(ctx):
+			status = data.StatusCancelled
+			event = errorEvent(CodeCancelled, "The generation was cancelled")
+		}
+		finish(status)
+		event.SessionID = gen.SessionID
+		send(event)
+		return gen, &GenerationError{Code: event.Code, Message: event.Message}
+	}
+
+	agent.Start()
+
+	send(ProgressEvent{
+		Type:       EventStart,
+		Message:    "Starting code generation...",
+		SessionID:  gen.SessionID,
+		ProjectDir: gen.ProjectName,
+	})
+
+	sendUsage := func() {
+		usage := agent.Usage()
+		send(ProgressEvent{Type: EventUsage, Usage: &usage})
+	}
+
+	if err := agent.GenerateCode(req.Prompt); err != nil {
+		agent.Stop()
+		sendUsage()
+		return fail(data.StatusFailed, errorEvent(CodeGenerationFailed, "Code generation failed: "+err.Error()))
+	}
+
+	gen.Result = agent.Finish()
+	for _, issue := range gen.Result.Issues {
+		send(ProgressEvent{
+			Type:    EventWarning,
+			Kind:    "issue",
+			Message: issue.Message,
+			File:    issue.File,
+		})
+	}
+	for _, finding := range gen.Result.Findings {
+		send(ProgressEvent{
+			Type:    EventWarning,
+			Kind:    "finding",
+			Message: fmt.Sprintf("[%s] %s (line %d)", finding.Severity, finding.Message, finding.Line),
+			File:    finding.File,
+		})
+	}
+	sendUsage()
+
+	if g.blocks(gen.Result) {
+		event := errorEvent(CodeBlocked, blockedMessage)
+		event.Result = gen.Result
+		return fail(data.StatusBlocked, event)
+	}
+
+	if req.DryRun {
+		gen.Contents = agent.Files()
+		finish(data.StatusComplete)
+		send(ProgressEvent{
+			Type:       EventComplete,
+			Message:    "Code generation complete!",
+			SessionID:  gen.SessionID,
+			ProjectDir: gen.ProjectName,
+			Result:     gen.Result,
+		})
+		return gen, nil
+	}
+
+	// The manifest marks the project as ready for download.
+	manifest, err := agent.WriteManifest(g.version)
+	if err == nil && req.OutputDir == "" {
+		err = g.publish(ctx, gen.SessionID, gen.ProjectDir, manifest.Paths())
+	}
+	if err != nil {
+		return fail(data.StatusFailed, errorEvent(CodeInternal, "Failed to store project: "+err.Error()))
+	}
+	gen.Manifest = &manifest
+	if req.OutputDir == "" {
+		gen.DownloadURL = "/download/" + gen.SessionID
+	}
+
+	// The project is stored before it is run, and the run works on a copy,
+	// so what is downloaded is what the model generated.
+	if req.Run {
+		run, err := g.runProject(ctx, agent, gen.ProjectDir, manifest.Paths(), func(stream, line string) {
+			send(ProgressEvent{
+				Type:    EventLog,
+				Kind:    "run",
+				Message: line,
+				Stream:  stream,
+			})
+		})
+		if err != nil {
+			send(ProgressEvent{
+				Type:    EventWarning,
+				Kind:    "run",
+				Message: "Failed to run project: " + err.Error(),
+			})
+		} else {
+			gen.Run = run
+			if record != nil {
+				record.TestsPassed = &run.Passed
+				record.TestOutput = run.Output()
+			}
+			send(ProgressEvent{
+				Type:    EventLog,
+				Kind:    "run",
+				Message: runMessage(run),
+				Run:     run,
+			})
+		}
+	}
+
+	finish(data.StatusComplete)
+
+	send(ProgressEvent{
+		Type:        EventComplete,
+		Message:     "Code generation complete!",
+		DownloadURL: gen.DownloadURL,
+		SessionID:   gen.SessionID,
+		ProjectDir:  gen.ProjectName,
+		Result:      gen.Result,
+		Run:         gen.Run,
+	})
+
+	return gen, nil
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRunStoresRedactedPrompt(t *testing.T) {
+	model := &heldModel{release: make(chan struct{})}
+	close(model.release)
+
+	codegens := newMemCodeGens()
+	srv := NewServer("test-key", t.TempDir(), codegens)
+	srv.generations.SetHTTPClient(&http.Client{Transport: model})
+
+	const key = "sk-proj-Ab3dEf6hIj9kLm2nOp5qRs8t"
+	gen, err := srv.generations.Run(context.Background(), ProjectRequest{
+		ID:          "1",
+		Prompt:      "Call OpenAI with " + key,
+		Language:    "go",
+		BasePackage: "example.com/app",
+		Template:    "go-gin",
+		Model:       "gpt-4o-mini",
+	}, nil)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	record, err := codegens.GetBySessionID(gen.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(record.Prompt, key) || !strings.Contains(record.Prompt, "[REDACTED OPENAI_KEY]") {
+		t.Errorf("stored prompt = %q, want the key redacted", record.Prompt)
+	}
+}
@@ -3,141 +3,144 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net"
 	"net/http"
-	"os"
-	"path/filepath"
-	"time"
+	"strings"
 
-	"github.com/google/uuid"
-	"github.com/tanvir-rifat007/codegen-ai-react/internal/agents"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/apierror"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/token"
 )
 
-// Add this new HTTP handler to your existing server.go file
-
+// HandleGenerateHTTP generates a project from a POSTed ProjectRequest. It
+// answers with a single JSON document, or streams progress as Server-Sent
+// Events when the client accepts text/event-stream.
 func (s *Server) HandleGenerateHTTP(w http.ResponseWriter, r *http.Request) {
-	// Only allow POST requests
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Set headers for JSON response
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	// Handle preflight requests
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	var req ProjectRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error": "Invalid JSON request"}`, http.StatusBadRequest)
-		return
-	}
-
-	projectName := req.ProjectName
-	if projectName == "" {
-		projectName = fmt.Sprintf("%s-project", req.Language)
-	}
-
-	sessionID := uuid.New().String()
-	sessionDir := filepath.Join(s.outputBase, sessionID)
-	if err := os.MkdirAll(sessionDir, 0755); err != nil {
-		http.Error(w, fmt.Sprintf(`{"error": "Failed to create session directory: %s"}`, err.Error()), http.StatusInternalServerError)
-		return
-	}
-
-	projectDir := filepath.Join(sessionDir, projectName)
-	if err := os.MkdirAll(projectDir, 0755); err != nil {
-		http.Error(w, fmt.Sprintf(`{"error": "Failed to create project directory: %s"}`, err.Error()), http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid JSON request")
 		return
 	}
 
-	ctx := context.Background()
-	httpClient := &http.Client{
-		Timeout: 1000 * time.Second,
-		Transport: &http.Transport{
-			MaxIdleConns:          100,
-			ResponseHeaderTimeout: 1000 * time.Second,
-			MaxIdleConnsPerHost:   100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			DisableCompression:    false,
-			ExpectContinueTimeout: 5 * time.Second,
-			DialContext: (&net.Dialer{
-				Timeout:   1000 * time.Second,
-				KeepAlive: 1000 * time.Second,
-			}).DialContext,
-		},
+	// Generations belong to the signed in user.
+	if user, ok := token.ContextGetUser(r); ok {
+		req.ID = user.ID
 	}
 
-	client := agents.NewOpenAI(ctx, s.openAIKey, req.Model, httpClient)
-
-	// For HTTP, we'll collect all progress messages and return them at the end
+	// Clients accepting text/event-stream are sent the WebSocket's progress
+	// events as they happen; everyone else gets one JSON response at the
+	// end. The stream starts with the first event, so requests failing
+	// validation are still answered with an error status.
+	stream := acceptsEventStream(r)
+	var sse *sseWriter
+	var sseErr error
+	stopHeartbeat := func() {}
+	defer func() { stopHeartbeat() }()
+
+	// Without a stream, progress is collected and returned at the end.
 	var progressMessages []string
-	progressCallback := func(eventType, message, file string) {
-		logMsg := fmt.Sprintf("[%s] %s", eventType, message)
-		if file != "" {
-			logMsg += fmt.Sprintf(" (file: %s)", file)
+	sink := SinkFunc(func(event ProgressEvent) {
+		if stream {
+			if sse == nil && sseErr == nil {
+				if sse, sseErr = newSSEWriter(w); sseErr == nil {
+					stopHeartbeat = sse.startHeartbeat(r.Context())
+				}
+			}
+			if sse != nil {
+				sse.send(event)
+			}
+			return
+		}
+
+		label := event.Type
+		if event.Kind != "" {
+			label = event.Kind
+		}
+		logMsg := fmt.Sprintf("[%s] %s", label, event.Message)
+		if event.File != "" {
+			logMsg += fmt.Sprintf(" (file: %s)", event.File)
 		}
 		progressMessages = append(progressMessages, logMsg)
 		log.Println(logMsg)
-	}
-
-	agent, err := agents.NewAgentWithCallback(
-		ctx, client, projectDir, req.BasePackage,
-		req.Template, req.Language, req.WorkerCount,
-		progressCallback,
-	)
+	})
 
-	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error": "Failed to initialize agent: %s"}`, err.Error()), http.StatusInternalServerError)
+	gen, err := s.generations.Run(context.Background(), req, sink)
+	if sse != nil {
+		// Run sent the final event.
 		return
 	}
-
-	agent.Start()
-
-	// Generate code
-	if err := agent.GenerateCode(req.Prompt); err != nil {
-		agent.Stop()
-		http.Error(w, fmt.Sprintf(`{"error": "Code generation failed: %s"}`, err.Error()), http.StatusInternalServerError)
+	if sseErr != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, sseErr.Error())
 		return
 	}
 
-	time.Sleep(1 * time.Second)
-	agent.Stop()
+	var genErr *GenerationError
+	if errors.As(err, &genErr) {
+		if genErr.Code == CodeBlocked {
+			// Blocked projects were generated, so the error comes with
+			// what was found in them.
+			body := apierror.Body(r, genErr.Code, genErr.Message)
+			body["status"] = "blocked"
+			body["projectName"] = gen.ProjectName
+			body["sessionId"] = gen.SessionID
+			body["progressMessages"] = progressMessages
+			body["files"] = gen.Result.Files
+			body["issues"] = gen.Result.Issues
+			body["findings"] = gen.Result.Findings
+			apierror.WriteBody(w, http.StatusUnprocessableEntity, body)
+			return
+		}
 
-	// Create zip file
-	zipName := fmt.Sprintf("%s.zip", projectName)
-	zipPath := filepath.Join(sessionDir, zipName)
+		// Field errors use the envelope of the API's validation errors.
+		if genErr.Errors != nil {
+			apierror.Write(w, r, http.StatusUnprocessableEntity, genErr.Code, genErr.Errors)
+			return
+		}
 
-	if err := createZip(projectDir, zipPath); err != nil {
-		http.Error(w, fmt.Sprintf(`{"error": "Failed to create zip file: %s"}`, err.Error()), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		switch genErr.Code {
+		case CodeBadRequest:
+			status = http.StatusBadRequest
+		case CodeUnavailable, CodeInterrupted:
+			status = http.StatusServiceUnavailable
+		}
+		apierror.Write(w, r, status, genErr.Code, genErr.Message)
 		return
 	}
 
-	zipURL := fmt.Sprintf("/download/%s", sessionID)
-
 	// Return success response
 	response := map[string]interface{}{
 		"status":           "success",
 		"message":          "Code generation complete!",
-		"projectName":      projectName,
-		"sessionId":        sessionID,
-		"zipUrl":           zipURL,
+		"projectName":      gen.ProjectName,
+		"sessionId":        gen.SessionID,
+		"zipUrl":           gen.DownloadURL,
 		"progressMessages": progressMessages,
+		"files":            gen.Result.Files,
+		"issues":           gen.Result.Issues,
+		"findings":         gen.Result.Findings,
+		"protocol":         gen.Result.Protocol,
+		"sampling":         gen.Result.Sampling,
+		"usage":            gen.Result.Usage,
+		"manifest":         gen.Manifest,
+		"run":              gen.Run,
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
-// Add this to your main function or router setup:
-// http.HandleFunc("/api/generate-http", server.HandleGenerateHTTP)
+// acceptsEventStream reports whether the client asked for Server-Sent Events.
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, _, _ := strings.Cut(part, ";")
+			if strings.EqualFold(strings.TrimSpace(mediaType), "text/event-stream") {
+				return true
+			}
+		}
+	}
+	return false
+}
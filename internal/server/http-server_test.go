@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/agents"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/data"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/token"
+)
+
+// plannedModel plans files and answers each unit request with the files it
+// asks for. The first meet unit requests wait for each other, so that
+// workers are known to overlap.
+type plannedModel struct {
+	files []string
+	meet  int
+
+	mutex   sync.Mutex
+	arrived int
+	met     chan struct{}
+}
+
+func (m *plannedModel) wait() {
+	m.mutex.Lock()
+	if m.met == nil {
+		m.met = make(chan struct{})
+	}
+	met := m.met
+	m.arrived++
+	if m.arrived == m.meet {
+		close(met)
+	}
+	m.mutex.Unlock()
+
+	<-met
+}
+
+func (m *plannedModel) RoundTrip(r *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var content string
+	if strings.Contains(string(body), "software architect") {
+		var plan agents.Plan
+		for _, f := range m.files {
+			plan.Files = append(plan.Files, agents.PlannedFile{Path: f, Responsibility: "part of the program"})
+		}
+		b, _ := json.Marshal(plan)
+		content = string(b)
+	} else {
+		m.wait()
+		for _, f := range m.files {
+			if strings.Contains(string(body), "- "+f+":") {
+				content += fmt.Sprintf("---FILE_PATH: %s\npackage main\n---END_FILE\n", f)
+			}
+		}
+	}
+
+	reply, _ := json.Marshal(map[string]any{
+		"choices": []any{map[string]any{"message": map[string]any{"content": content}}},
+		"usage":   map[string]any{"total_tokens": 10},
+	})
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(string(reply))),
+		Request:    r,
+	}, nil
+}
+
+func TestGenerateHTTPCollectsConcurrentProgress(t *testing.T) {
+	// The log's lock would order the sink's calls and hide races.
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	model := &plannedModel{files: []string{"a.go", "b.go", "c.go", "d.go", "main.go"}, meet: 2}
+	srv := NewServer("test-key", t.TempDir(), newMemCodeGens())
+	srv.generations.SetHTTPClient(&http.Client{Transport: model})
+
+	body := `{"prompt": "Print hello", "language": "go", "basePackage": "example.com/app", "template": "go-gin", "model": "gpt-4o-mini", "plan": true, "workerCount": 4}`
+	r := httptest.NewRequest(http.MethodPost, "/api/generate-http", strings.NewReader(body))
+	r = token.ContextSetUser(r, &data.User{ID: "1"})
+	w := httptest.NewRecorder()
+
+	srv.HandleGenerateHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+
+	var response struct {
+		ProgressMessages []string `json:"progressMessages"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range model.files {
+		want := fmt.Sprintf("(file: %s)", f)
+		found := false
+		for _, msg := range response.ProgressMessages {
+			if strings.Contains(msg, "Generated planned file") && strings.HasSuffix(msg, want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("no progress message for generating %s in %q", f, response.ProgressMessages)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package server
+
+// The /api/generate WebSocket speaks a small, versioned JSON protocol.
+//
+// A connection opens with the client's hello listing the protocol versions
+// it speaks:
+//
+//	{"type": "hello", "versions": [1]}
+//
+// The server answers with a hello event naming the version it picked, its
+// own version and the heartbeat interval in seconds. When it speaks none of
+// the versions it sends an unsupported_version error and closes.
+//
+//	{"v": 1, "seq": 1, "type": "hello", "serverVersion": "1.0.0", "heartbeat": 30}
+//
+// The client then sends generate requests, one at a time. The requestId is
+// echoed in every event of the request; the server picks one when it is
+// left out. A request sent while another is running is rejected with a busy
+// error.
+//
+//	{"type": "generate", "requestId": "r1", "request": {"prompt": "...", ...}}
+//
+// Every event carries the protocol version in v and a sequence number that
+// starts at 1 and grows by one per event on the connection. A request emits
+// start, then any number of plan, file, log, usage and warning events, and
+// ends with exactly one complete or error event. Error events carry a
+// machine readable code next to the message. Requests failing validation
+// are answered with a failed_validation error whose errors map the invalid
+// fields to what is wrong with them:
+//
+//	{"v": 1, "seq": 2, "type": "error", "code": "failed_validation", "message": "...", "errors": {"prompt": "must be provided"}}
+//
+// Events from start on are also stored with the session, numbered from 1 in
+// id. A client that lost its connection reconnects, says hello and resumes
+// the session with the id of the last event it saw. It is sent the events
+// it missed and then follows the generation until its final event. The
+// same replay is served as Server-Sent Events by
+// GET /api/sessions/{id}/events.
+//
+//	{"type": "resume", "requestId": "r2", "sessionId": "...", "lastEventId": 12}
+//
+// Generations don't depend on the connection that started them: they go on
+// when it drops and end only when they finish, the server shuts down or
+// the client cancels them, from any connection, by session ID. Cancelled
+// generations end with a cancelled error.
+//
+//	{"type": "cancel", "requestId": "r3", "sessionId": "..."}
+//
+// When the server shuts down it sends a draining event. Running generations
+// go on until the shutdown deadline, then end with an interrupted error; new
+// generate requests are refused with an unavailable error. Clients should
+// reconnect and resume once their generation ends or the connection drops.
+//
+// The server sends a ping event and a WebSocket ping every heartbeat.
+// Clients may answer the event with {"type": "pong"}; connections that stay
+// silent for two heartbeats are closed.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/agents"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/apierror"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/data"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/runner"
+)
+
+// ProtocolVersion is the newest version of the WebSocket protocol the server
+// speaks.
+const ProtocolVersion = 1
+
+// Messages sent by the client.
+const (
+	MessageHello    = "hello"
+	MessageGenerate = "generate"
+	MessageResume   = "resume"
+	MessageCancel   = "cancel"
+	MessagePong     = "pong"
+)
+
+// Events sent by the server.
+const (
+	EventHello    = "hello"
+	EventStart    = "start"
+	EventPlan     = "plan"
+	EventFile     = "file"
+	EventLog      = "log"
+	EventUsage    = "usage"
+	EventWarning  = "warning"
+	EventError    = "error"
+	EventComplete = "complete"
+	EventPing     = "ping"
+	EventDraining = "draining"
+)
+
+// Codes of error events. Those shared with HTTP error responses are the
+// same strings.
+const (
+	CodeBadRequest         = apierror.CodeBadRequest
+	CodeFailedValidation   = apierror.CodeFailedValidation
+	CodeUnsupportedVersion = "unsupported_version"
+	CodeBusy               = "busy"
+	CodeNotFound           = apierror.CodeNotFound
+	CodeForbidden          = apierror.CodeForbidden
+	CodeGenerationFailed   = "generation_failed"
+	CodeBlocked            = apierror.CodeBlocked
+	CodeUnavailable        = apierror.CodeUnavailable
+	CodeInterrupted        = "interrupted"
+	CodeCancelled          = "cancelled"
+	CodeInternal           = apierror.CodeInternal
+)
+
+const (
+	heartbeatInterval = 30 * time.Second
+	helloTimeout      = 10 * time.Second
+	writeTimeout      = 10 * time.Second
+
+	// maxMessageSize leaves room for a base64 encoded context zip.
+	maxMessageSize = 2 * maxContextZipSize
+)
+
+// ClientMessage is a message sent by the client.
+type ClientMessage struct {
+	Type string `json:"type"`
+
+	// Versions lists the protocol versions the client speaks (hello).
+	Versions []int `json:"versions,omitempty"`
+
+	// RequestID and Request describe a generation (generate).
+	RequestID string          `json:"requestId,omitempty"`
+	Request   *ProjectRequest `json:"request,omitempty"`
+
+	// SessionID and LastEventID pick the events to replay (resume).
+	SessionID   string `json:"sessionId,omitempty"`
+	LastEventID int64  `json:"lastEventId,omitempty"`
+}
+
+// ProgressEvent is an event sent by the server.
+type ProgressEvent struct {
+	Version   int    `json:"v"`
+	Seq       int64  `json:"seq"`
+	Type      string `json:"type"`
+	RequestID string `json:"requestId,omitempty"`
+	// ID numbers the events of a session from 1, for resuming.
+	ID int64 `json:"id,omitempty"`
+
+	// Kind refines log, warning and file events, for example repair or
+	// test.
+	Kind    string `json:"kind,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+	File    string `json:"file,omitempty"`
+	Stream  string `json:"stream,omitempty"`
+
+	// Errors maps the invalid fields of a failed_validation error to what
+	// is wrong with them.
+	Errors map[string]string `json:"errors,omitempty"`
+
+	SessionID   string `json:"sessionId,omitempty"`
+	ProjectDir  string `json:"projectDir,omitempty"`
+	DownloadURL string `json:"downloadUrl,omitempty"`
+
+	// ServerVersion and Heartbeat are sent in the hello event.
+	ServerVersion string `json:"serverVersion,omitempty"`
+	Heartbeat     int    `json:"heartbeat,omitempty"`
+
+	Usage  *agents.Usage            `json:"usage,omitempty"`
+	Result *agents.GenerationResult `json:"result,omitempty"`
+	Run    *runner.Result           `json:"run,omitempty"`
+}
+
+// errorEvent returns an error event with the given code.
+func errorEvent(code, message string) ProgressEvent {
+	return ProgressEvent{Type: EventError, Code: code, Message: message}
+}
+
+// agentEvent maps an agent progress callback onto a protocol event.
+func agentEvent(eventType, message, file string) ProgressEvent {
+	kind := eventType
+
+	switch {
+	case file != "" && message == agents.MessageWritingFile:
+		if kind == "file" {
+			kind = ""
+		}
+		return ProgressEvent{Type: EventFile, Kind: kind, Message: message, File: file}
+	case eventType == "plan":
+		return ProgressEvent{Type: EventPlan, Message: message, File: file}
+	case eventType == "guard", eventType == "protocol":
+		return ProgressEvent{Type: EventWarning, Kind: kind, Message: message, File: file}
+	}
+
+	return ProgressEvent{Type: EventLog, Kind: kind, Message: message, File: file}
+}
+
+// negotiate picks the newest protocol version both sides speak, or 0.
+func negotiate(versions []int) int {
+	for v := ProtocolVersion; v > 0; v-- {
+		if slices.Contains(versions, v) {
+			return v
+		}
+	}
+	return 0
+}
+
+// hello waits for the client's hello and answers it. It reports whether the
+// connection can be used.
+func (s *Server) hello(client *WebSocketClient) bool {
+	client.conn.SetReadDeadline(time.Now().Add(helloTimeout))
+
+	var msg ClientMessage
+	if err := client.conn.ReadJSON(&msg); err != nil {
+		client.close(websocket.CloseProtocolError, errorEvent(CodeBadRequest, "Invalid hello: "+err.Error()))
+		return false
+	}
+
+	if msg.Type != MessageHello {
+		client.close(websocket.CloseProtocolError, errorEvent(CodeBadRequest, "Expected a hello message, got "+msg.Type))
+		return false
+	}
+
+	version := negotiate(msg.Versions)
+	if version == 0 {
+		client.close(websocket.CloseProtocolError, errorEvent(CodeUnsupportedVersion, "None of the requested protocol versions are supported"))
+		return false
+	}
+
+	client.version = version
+	sendEvent(client, ProgressEvent{
+		Type:          EventHello,
+		ServerVersion: s.generations.version,
+		Heartbeat:     int(heartbeatInterval / time.Second),
+	})
+
+	return true
+}
+
+// readMessages reads client messages until the connection fails, handing
+// generate and resume requests to requests. Requests arriving while one is running
+// are rejected. Cancel messages are handled right away.
+func (s *Server) readMessages(client *WebSocketClient, user *data.User, requests chan<- ClientMessage, busy *atomic.Bool) {
+	conn := client.conn
+	extend := func() {
+		conn.SetReadDeadline(time.Now().Add(2 * heartbeatInterval))
+	}
+	conn.SetPongHandler(func(string) error {
+		extend()
+		return nil
+	})
+
+	for {
+		extend()
+
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && !errors.Is(err, context.Canceled) {
+				log.Printf("Error reading from websocket: %v", err)
+			}
+			return
+		}
+
+		var msg ClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			sendEvent(client, errorEvent(CodeBadRequest, "Invalid message: "+err.Error()))
+			continue
+		}
+
+		switch msg.Type {
+		case MessagePong:
+		case MessageCancel:
+			s.cancelGeneration(client, user, msg)
+		case MessageGenerate, MessageResume:
+			if msg.RequestID == "" {
+				msg.RequestID = uuid.New().String()
+			}
+
+			problem := ""
+			switch {
+			case msg.Type == MessageGenerate && msg.Request == nil:
+				problem = "Generate message without a request"
+			case msg.Type == MessageResume && msg.SessionID == "":
+				problem = "Resume message without a sessionId"
+			case msg.LastEventID < 0:
+				problem = errBadLastEventID.Error()
+			}
+			if problem != "" {
+				event := errorEvent(CodeBadRequest, problem)
+				event.RequestID = msg.RequestID
+				sendEvent(client, event)
+				continue
+			}
+
+			if !busy.CompareAndSwap(false, true) {
+				event := errorEvent(CodeBusy, "Another request is still running on this connection")
+				event.RequestID = msg.RequestID
+				sendEvent(client, event)
+				continue
+			}
+
+			requests <- msg
+		default:
+			sendEvent(client, errorEvent(CodeBadRequest, "Unknown message type "+msg.Type))
+		}
+	}
+}
+
+// heartbeat pings the client until ctx is done.
+func (c *WebSocketClient) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+			sendEvent(c, ProgressEvent{Type: EventPing})
+		}
+	}
+}
+
+// close sends a final event and closes the connection with code.
+func (c *WebSocketClient) close(code int, event ProgressEvent) {
+	sendEvent(c, event)
+
+	// Close reasons are limited to 123 bytes.
+	reason := event.Message
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+
+	msg := websocket.FormatCloseMessage(code, reason)
+	c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
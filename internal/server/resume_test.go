@@ -0,0 +1,311 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/data"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/token"
+)
+
+// memCodeGens keeps generations and their events in memory.
+type memCodeGens struct {
+	mutex   sync.Mutex
+	records map[string]*data.CodenGen
+	events  map[string][]data.Event
+}
+
+func newMemCodeGens() *memCodeGens {
+	return &memCodeGens{
+		records: make(map[string]*data.CodenGen),
+		events:  make(map[string][]data.Event),
+	}
+}
+
+func (m *memCodeGens) Create(cg *data.CodenGen) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if cg.Status == "" {
+		cg.Status = data.StatusRunning
+	}
+	record := *cg
+	m.records[cg.SessionID] = &record
+	return nil
+}
+
+func (m *memCodeGens) UpdateStatus(cg *data.CodenGen) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	record := *cg
+	m.records[cg.SessionID] = &record
+	return nil
+}
+
+func (m *memCodeGens) GetBySessionID(sessionID string) (*data.CodenGen, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	record, ok := m.records[sessionID]
+	if !ok {
+		return nil, data.ErrRecordNotFound
+	}
+	cg := *record
+	return &cg, nil
+}
+
+func (m *memCodeGens) GetAllByUserID(userID int) ([]*data.CodenGen, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var records []*data.CodenGen
+	for _, record := range m.records {
+		if record.UserID == userID {
+			cg := *record
+			records = append(records, &cg)
+		}
+	}
+	return records, nil
+}
+
+func (m *memCodeGens) MarkInterrupted(sessionIDs []string) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var n int64
+	for _, id := range sessionIDs {
+		if record, ok := m.records[id]; ok && record.Status == data.StatusRunning {
+			record.Status = data.StatusInterrupted
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memCodeGens) AppendEvent(e *data.Event) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.events[e.SessionID] = append(m.events[e.SessionID], *e)
+	return nil
+}
+
+func (m *memCodeGens) EventsAfter(sessionID string, after int64) ([]data.Event, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var events []data.Event
+	for _, e := range m.events[sessionID] {
+		if e.Seq > after {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// heldModel answers every model request with a one-file project once
+// released, or fails it when the request is cancelled first.
+type heldModel struct {
+	release chan struct{}
+}
+
+const heldModelReply = `{"choices": [{"message": {"content": "---FILE_PATH: main.go\npackage main\n\nfunc main() {}\n---END_FILE"}}], "usage": {"total_tokens": 10}}`
+
+func (m *heldModel) RoundTrip(r *http.Request) (*http.Response, error) {
+	select {
+	case <-m.release:
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(heldModelReply)),
+		Request:    r,
+	}, nil
+}
+
+// newTestServer serves the generation WebSocket of a server recording to
+// memory and generating with model, for user 1.
+func newTestServer(t *testing.T, model http.RoundTripper) (*Server, *httptest.Server) {
+	t.Helper()
+
+	srv := NewServer("test-key", t.TempDir(), newMemCodeGens())
+	srv.generations.SetHTTPClient(&http.Client{Transport: model})
+
+	user := &data.User{ID: "1"}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.HandleGenerate(w, token.ContextSetUser(r, user))
+	}))
+	t.Cleanup(ts.Close)
+
+	return srv, ts
+}
+
+// dial connects to the generation WebSocket and says hello.
+func dial(t *testing.T, ts *httptest.Server) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+
+	if err := conn.WriteJSON(ClientMessage{Type: MessageHello, Versions: []int{ProtocolVersion}}); err != nil {
+		t.Fatalf("sending hello: %v", err)
+	}
+	if event := readEvent(t, conn); event.Type != EventHello {
+		t.Fatalf("got %s event, want hello", event.Type)
+	}
+
+	return conn
+}
+
+func readEvent(t *testing.T, conn *websocket.Conn) ProgressEvent {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	var event ProgressEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("reading event: %v", err)
+	}
+	return event
+}
+
+// readUntil reads events until one that stop accepts.
+func readUntil(t *testing.T, conn *websocket.Conn, stop func(ProgressEvent) bool) ProgressEvent {
+	t.Helper()
+
+	for {
+		if event := readEvent(t, conn); stop(event) {
+			return event
+		}
+	}
+}
+
+// waitDisconnected waits until the server noticed that its clients left.
+func waitDisconnected(t *testing.T, srv *Server) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		srv.clientsMutex.Lock()
+		n := len(srv.clients)
+		srv.clientsMutex.Unlock()
+		if n == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clients still connected", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGenerationOutlivesConnection(t *testing.T) {
+	model := &heldModel{release: make(chan struct{})}
+	srv, ts := newTestServer(t, model)
+
+	conn := dial(t, ts)
+	err := conn.WriteJSON(ClientMessage{
+		Type:      MessageGenerate,
+		RequestID: "r1",
+		Request: &ProjectRequest{
+			Prompt:      "Print hello",
+			Language:    "go",
+			BasePackage: "example.com/app",
+			Template:    "go-gin",
+			Model:       "gpt-4o-mini",
+		},
+	})
+	if err != nil {
+		t.Fatalf("sending generate: %v", err)
+	}
+
+	start := readUntil(t, conn, func(e ProgressEvent) bool {
+		return e.Type == EventStart || finalEvent(e)
+	})
+	if start.Type != EventStart {
+		t.Fatalf("got %s event %q, want start", start.Type, start.Message)
+	}
+
+	// The model answers only once the connection is gone.
+	conn.Close()
+	waitDisconnected(t, srv)
+	close(model.release)
+
+	conn = dial(t, ts)
+	defer conn.Close()
+
+	err = conn.WriteJSON(ClientMessage{
+		Type:        MessageResume,
+		RequestID:   "r2",
+		SessionID:   start.SessionID,
+		LastEventID: start.ID,
+	})
+	if err != nil {
+		t.Fatalf("sending resume: %v", err)
+	}
+
+	final := readUntil(t, conn, finalEvent)
+	if final.Type != EventComplete {
+		t.Fatalf("got %s event %q (%s), want complete", final.Type, final.Message, final.Code)
+	}
+	if final.RequestID != "r2" {
+		t.Errorf("final event has requestId %q, want r2", final.RequestID)
+	}
+	if final.SessionID != start.SessionID {
+		t.Errorf("final event has sessionId %q, want %q", final.SessionID, start.SessionID)
+	}
+}
+
+func TestCancelGeneration(t *testing.T) {
+	model := &heldModel{release: make(chan struct{})}
+	defer close(model.release)
+	_, ts := newTestServer(t, model)
+
+	conn := dial(t, ts)
+	defer conn.Close()
+
+	err := conn.WriteJSON(ClientMessage{
+		Type:      MessageGenerate,
+		RequestID: "r1",
+		Request: &ProjectRequest{
+			Prompt:      "Print hello",
+			Language:    "go",
+			BasePackage: "example.com/app",
+			Template:    "go-gin",
+			Model:       "gpt-4o-mini",
+		},
+	})
+	if err != nil {
+		t.Fatalf("sending generate: %v", err)
+	}
+
+	start := readUntil(t, conn, func(e ProgressEvent) bool {
+		return e.Type == EventStart || finalEvent(e)
+	})
+	if start.Type != EventStart {
+		t.Fatalf("got %s event %q, want start", start.Type, start.Message)
+	}
+
+	if err := conn.WriteJSON(ClientMessage{Type: MessageCancel, RequestID: "r2", SessionID: start.SessionID}); err != nil {
+		t.Fatalf("sending cancel: %v", err)
+	}
+
+	final := readUntil(t, conn, finalEvent)
+	if final.Type != EventError || final.Code != CodeCancelled {
+		t.Fatalf("got %s event %q (%s), want a cancelled error", final.Type, final.Message, final.Code)
+	}
+	if final.RequestID != "r1" {
+		t.Errorf("final event has requestId %q, want r1", final.RequestID)
+	}
+}
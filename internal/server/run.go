@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/agents"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/guard"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/runner"
+)
+
+// SetRunLimits sets the sandbox limits generated projects are run under.
+func (s *Server) SetRunLimits(limits runner.Limits) {
+	s.generations.SetRunLimits(limits)
+}
+
+// SetRunLimits sets the sandbox limits generated projects are run under.
+func (g *GenerationService) SetRunLimits(limits runner.Limits) {
+	g.runLimits = limits
+}
+
+// runProject executes the template's dependency, build and test commands on
+// a throwaway copy of the project's files. The stored project may be the
+// project directory itself, so the commands never get to touch it. Only the
+// dependency commands are let onto the network.
+func (g *GenerationService) runProject(ctx context.Context, agent *agents.Agent, projectDir string, files []string, output runner.OutputFunc) (*runner.Result, error) {
+	tmpl, _ := agent.Template()
+
+	var steps []runner.Step
+	for _, c := range tmpl.Deps {
+		steps = append(steps, runner.Step{Stage: "deps", Command: c, Network: true})
+	}
+	for _, c := range tmpl.Build {
+		steps = append(steps, runner.Step{Stage: "build", Command: c})
+	}
+	for _, c := range tmpl.Test {
+		steps = append(steps, runner.Step{Stage: "test", Command: c})
+	}
+
+	workDir, err := os.MkdirTemp("", "runner-project-")
+	if err != nil {
+		return nil, fmt.Errorf("creating run directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	if err := copyProject(workDir, projectDir, files); err != nil {
+		return nil, fmt.Errorf("copying project: %w", err)
+	}
+
+	return runner.Run(ctx, workDir, steps, g.runLimits, output)
+}
+
+// copyProject copies the listed files of a project, slash separated paths
+// relative to src, to dst.
+func copyProject(dst, src string, files []string) error {
+	for _, name := range files {
+		from := filepath.Join(src, filepath.FromSlash(name))
+		to := filepath.Join(dst, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return err
+		}
+		if err := copyFile(to, from); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("not a regular file")
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// SetBlockUnsafe withholds the download of projects with high severity
+// guard findings.
+func (s *Server) SetBlockUnsafe(block bool) {
+	s.generations.SetBlockUnsafe(block)
+}
+
+// SetBlockUnsafe withholds the download of projects with high severity
+// guard findings.
+func (g *GenerationService) SetBlockUnsafe(block bool) {
+	g.blockUnsafe = block
+}
+
+func (g *GenerationService) blocks(result *agents.GenerationResult) bool {
+	return g.blockUnsafe && guard.Blocking(result.Findings)
+}
+
+func runMessage(run *runner.Result) string {
+	if run.Passed {
+		return "Build and tests passed"
+	}
+	return "Build or tests failed"
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyProject(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(src, "cmd", "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"go.mod":          "module example.com/app\n",
+		"cmd/app/main.go": "package main\n",
+		"unlisted.txt":    "left behind\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(src, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := copyProject(dst, src, []string{"go.mod", "cmd/app/main.go"}); err != nil {
+		t.Fatalf("copyProject: %v", err)
+	}
+
+	for _, name := range []string{"go.mod", "cmd/app/main.go"} {
+		got, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("reading copied %s: %v", name, err)
+		}
+		if string(got) != files[name] {
+			t.Errorf("copied %s = %q, want %q", name, got, files[name])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, "unlisted.txt")); !os.IsNotExist(err) {
+		t.Errorf("unlisted file was copied: %v", err)
+	}
+}
+
+func TestCopyProjectRejectsNonRegularFiles(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(src, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyProject(dst, src, []string{"dir"}); err == nil {
+		t.Fatal("copyProject copied a directory listed as a file")
+	}
+}
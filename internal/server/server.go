@@ -3,40 +3,53 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/tanvir-rifat007/codegen-ai-react/internal/agents"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/apierror"
 	"github.com/tanvir-rifat007/codegen-ai-react/internal/data"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/storage"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/token"
 )
 
 type Server struct {
-	agent      *agents.Agent
-	upgrader   websocket.Upgrader
-	openAIKey  string
-	outputBase string
+	agent    *agents.Agent
+	upgrader websocket.Upgrader
 
-	codegenModel *data.CodeGenModel
+	codegenModel CodeGenStore
+	generations  *GenerationService
+
+	// clients are the connected WebSocket clients, told when the server
+	// drains.
+	clientsMutex sync.Mutex
+	clients      map[*WebSocketClient]struct{}
 }
 
 type WebSocketClient struct {
 	conn       *websocket.Conn
 	writeMutex sync.Mutex
+
+	// version is the negotiated protocol version and seq the sequence
+	// number of the last event sent.
+	version int
+	seq     int64
+	// gone is set once a write failed; nothing is sent after it.
+	gone bool
 }
 
 func NewWebSocketClient(conn *websocket.Conn) *WebSocketClient {
 	return &WebSocketClient{
-		conn: conn,
+		conn:    conn,
+		version: ProtocolVersion,
 	}
 }
 
@@ -55,271 +68,229 @@ type ProjectRequest struct {
 	WorkerCount int    `json:"workerCount"`
 	Model       string `json:"model"`
 	ProjectName string `json:"projectName"`
+
+	// ContextZip is a base64 encoded zip of an existing project whose files
+	// are sent to the model as context.
+	ContextZip    []byte `json:"contextZip,omitempty"`
+	ContextTokens int    `json:"contextTokens,omitempty"`
+
+	// Plan generates the project file by file from a model-written plan.
+	Plan bool `json:"plan,omitempty"`
+
+	// RepairRounds is how many times files that fail to parse are sent back
+	// to the model for fixing.
+	RepairRounds int `json:"repairRounds,omitempty"`
+
+	// WithTests adds a stage generating unit tests for every source file.
+	WithTests bool `json:"withTests,omitempty"`
+
+	// Run executes the template's build and test commands in a sandbox once
+	// the project is generated.
+	Run bool `json:"run,omitempty"`
+
+	// Protocol is how the model returns files: delimited (the default),
+	// json, json_schema or tools.
+	Protocol string `json:"protocol,omitempty"`
+
+	// Sampling overrides the template's default sampling parameters.
+	Sampling agents.SamplingParams `json:"sampling"`
+
+	// License is the SPDX identifier of the LICENSE added to the project,
+	// overriding the template's default; "none" adds no license.
+	License       string `json:"license,omitempty"`
+	LicenseHolder string `json:"licenseHolder,omitempty"`
+
+	// The fields below can't be set by clients; they let local callers such
+	// as the CLI adjust a generation.
+
+	// OutputDir is where the project is written instead of a new session
+	// directory below the output base. The project is left there and not
+	// copied to the artifact store.
+	OutputDir string `json:"-"`
+	// DryRun generates the files without writing them or a manifest.
+	DryRun bool `json:"-"`
+	// NoAutoFix leaves package and import path mismatches in generated Go
+	// code alone.
+	NoAutoFix bool `json:"-"`
+	// Context is used instead of ContextZip when set.
+	Context *agents.ProjectContext `json:"-"`
 }
 
-type ProgressEvent struct {
-	Type       string `json:"type"`
-	Message    string `json:"message"`
-	File       string `json:"file,omitempty"`
-	Error      string `json:"error,omitempty"`
-	ZipURL     string `json:"zipUrl,omitempty"`
-	ProjectDir string `json:"projectDir,omitempty"`
+const maxContextZipSize = 10 << 20
+
+// projectContext loads the existing project files attached to the request,
+// if any.
+func (req *ProjectRequest) projectContext() (*agents.ProjectContext, error) {
+	if len(req.ContextZip) == 0 {
+		return nil, nil
+	}
+
+	if len(req.ContextZip) > maxContextZipSize {
+		return nil, fmt.Errorf("context zip must not be larger than %d bytes", maxContextZipSize)
+	}
+
+	return agents.LoadContextZip(req.ContextZip, req.Prompt, req.ContextTokens)
 }
 
-func NewServer(openAIKey, outputBase string, codegenModel *data.CodeGenModel) *Server {
+func NewServer(openAIKey, outputBase string, codegenModel CodeGenStore) *Server {
 	if err := os.MkdirAll(outputBase, 0755); err != nil {
 		log.Printf("Failed to create output base directory: %v", err)
 	}
 
+	generations := NewGenerationService(openAIKey, outputBase, codegenModel)
+	if store, err := storage.NewLocal(outputBase); err != nil {
+		log.Printf("Failed to create artifact store: %v", err)
+	} else {
+		generations.SetArtifactStore(store)
+	}
+
 	return &Server{
-		openAIKey:  openAIKey,
-		outputBase: outputBase,
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true
 			},
+			Error: upgradeError,
 		},
 		codegenModel: codegenModel,
+		generations:  generations,
+		clients:      make(map[*WebSocketClient]struct{}),
 	}
 }
 
+// SetVersion sets the generator version recorded in project manifests.
+func (s *Server) SetVersion(version string) {
+	s.generations.SetVersion(version)
+}
+
+// Generations returns the service running the server's generations.
+func (s *Server) Generations() *GenerationService {
+	return s.generations
+}
+
+// upgradeError answers a failed WebSocket handshake.
+func upgradeError(w http.ResponseWriter, r *http.Request, status int, reason error) {
+	code := apierror.CodeBadRequest
+	switch status {
+	case http.StatusForbidden:
+		code = apierror.CodeForbidden
+	case http.StatusMethodNotAllowed:
+		code = apierror.CodeMethodNotAllowed
+	}
+	apierror.Write(w, r, status, code, reason.Error())
+}
+
+// HandleGenerate serves the generation WebSocket. See protocol.go for the
+// messages it exchanges.
 func (s *Server) HandleGenerate(w http.ResponseWriter, r *http.Request) {
 
+	// Upgrade answers failed handshakes itself, through upgradeError.
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		http.Error(w, "Could not upgrade connection", http.StatusInternalServerError)
 		return
 	}
 	defer conn.Close()
 
+	conn.SetReadLimit(maxMessageSize)
 	wsClient := NewWebSocketClient(conn)
 
-	var req ProjectRequest
-	err = conn.ReadJSON(&req)
-	if err != nil {
-		sendEvent(wsClient, ProgressEvent{
-			Type:  "error",
-			Error: "Invalid request: " + err.Error(),
-		})
-		return
-	}
-
-	// Convert string ID to int
-	userID, err := strconv.Atoi(req.ID)
-	if err != nil {
-		sendEvent(wsClient, ProgressEvent{
-			Type:  "error",
-			Error: "Invalid user ID format: " + err.Error(),
-		})
-		return
-	}
-
-	// Validate user ID
-	if userID == 0 {
-		sendEvent(wsClient, ProgressEvent{
-			Type:  "error",
-			Error: "User ID is required",
-		})
-		return
-	}
-
-	projectName := req.ProjectName
-	if projectName == "" {
-		projectName = fmt.Sprintf("%s-project", req.Language)
-	}
-
-	// Create database record
-	codegenRecord := &data.CodenGen{
-		UserID:      userID,
-		Language:    req.Language,
-		Template:    req.Template,
-		BasePackage: req.BasePackage,
-		Workers:     req.WorkerCount,
-		Model:       req.Model,
-		ProjectName: projectName,
-		Prompt:      req.Prompt,
-	}
-
-	// Save to database (you'll need to pass your CodeGenModel instance to the server)
-	if err := s.codegenModel.Create(codegenRecord); err != nil {
-		sendEvent(wsClient, ProgressEvent{
-			Type:  "error",
-			Error: "Failed to save generation request: " + err.Error(),
-		})
-		return
-	}
-
-	sessionID := uuid.New().String()
-
-	sessionDir := filepath.Join(s.outputBase, sessionID)
-	if err := os.MkdirAll(sessionDir, 0755); err != nil {
-		sendEvent(wsClient, ProgressEvent{
-			Type:  "error",
-			Error: "Failed to create session directory: " + err.Error(),
-		})
-		return
-	}
-
-	projectDir := filepath.Join(sessionDir, projectName)
-	if err := os.MkdirAll(projectDir, 0755); err != nil {
-		sendEvent(wsClient, ProgressEvent{
-			Type:  "error",
-			Error: "Failed to create project directory: " + err.Error(),
-		})
+	if !s.hello(wsClient) {
 		return
 	}
-
-	ctx := context.Background()
-	httpClient := &http.Client{
-		Timeout: 1000 * time.Second,
-		Transport: &http.Transport{
-			MaxIdleConns:          100,
-			ResponseHeaderTimeout: 1000 * time.Second,
-			MaxIdleConnsPerHost:   100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			DisableCompression:    false,
-			ExpectContinueTimeout: 5 * time.Second,
-			DialContext: (&net.Dialer{
-				Timeout:   1000 * time.Second,
-				KeepAlive: 1000 * time.Second,
-			}).DialContext,
-		},
-	}
-
-	client := agents.NewOpenAI(ctx, s.openAIKey, req.Model, httpClient)
-
-	progressCallback := func(eventType, message, file string) {
-		sendEvent(wsClient, ProgressEvent{
-			Type:       eventType,
-			Message:    message,
-			File:       file,
-			ProjectDir: projectName,
-		})
+	defer s.addClient(wsClient)()
+
+	user, _ := token.ContextGetUser(r)
+
+	// ctx ends with the connection, stopping its heartbeat and resumes.
+	// Generations don't use it: they go on when the client goes away, to
+	// be followed again by resuming.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go wsClient.heartbeat(ctx)
+
+	// At most one request is queued, as busy rejects the rest.
+	requests := make(chan ClientMessage, 1)
+	var busy atomic.Bool
+	go func() {
+		defer cancel()
+		s.readMessages(wsClient, user, requests, &busy)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-requests:
+			go func() {
+				defer busy.Store(false)
+				if msg.Type == MessageResume {
+					s.resume(ctx, wsClient, user, msg)
+				} else {
+					s.generate(wsClient, msg.RequestID, user, *msg.Request)
+				}
+			}()
+		}
 	}
+}
 
-	agent, err := agents.NewAgentWithCallback(
-		ctx, client, projectDir, req.BasePackage,
-		req.Template, req.Language, req.WorkerCount,
-		progressCallback,
-	)
-
-	if err != nil {
-		sendEvent(wsClient, ProgressEvent{
-			Type:  "error",
-			Error: "Failed to initialize agent: " + err.Error(),
-		})
-		return
+// generate runs one generation request, reporting its progress to client
+// for as long as it stays connected. Drain or a cancel message stop it.
+func (s *Server) generate(wsClient *WebSocketClient, requestID string, user *data.User, req ProjectRequest) {
+	send := func(event ProgressEvent) {
+		event.RequestID = requestID
+		sendEvent(wsClient, event)
 	}
 
-	agent.Start()
-
-	sendEvent(wsClient, ProgressEvent{
-		Type:    "start",
-		Message: "Starting code generation...",
-	})
-
-	if err := agent.GenerateCode(req.Prompt); err != nil {
-		sendEvent(wsClient, ProgressEvent{
-			Type:  "error",
-			Error: "Code generation failed: " + err.Error(),
-		})
-		agent.Stop()
-		return
+	// Generations belong to the signed in user.
+	if user != nil {
+		req.ID = user.ID
 	}
 
-	time.Sleep(1 * time.Second)
-	agent.Stop()
-
-	zipName := fmt.Sprintf("%s.zip", projectName)
-	zipPath := filepath.Join(sessionDir, zipName)
-
-	sendEvent(wsClient, ProgressEvent{
-		Type:  "file",
-		Error: "Generating zip file: " + zipName,
-	})
+	gen, err := s.generations.Run(context.Background(), req, SinkFunc(send))
 
-	if err := createZip(projectDir, zipPath); err != nil {
-		sendEvent(wsClient, ProgressEvent{
-			Type:  "error",
-			Error: "Failed to create zip file: " + err.Error(),
-		})
+	// Once a generation started, its final event was sent by Run.
+	var genErr *GenerationError
+	if gen == nil && errors.As(err, &genErr) {
+		event := errorEvent(genErr.Code, genErr.Message)
+		event.Errors = genErr.Errors
+		send(event)
 	}
-
-	zipURL := "/download/" + sessionID
-	sendEvent(wsClient, ProgressEvent{
-		Type:    "complete",
-		Message: "Code generation complete!",
-		ZipURL:  zipURL,
-	})
 }
 
-func (s *Server) HandleDownload(w http.ResponseWriter, r *http.Request) {
-	sessionID := r.URL.Path[len("/download/"):]
-
-	sessionDir := filepath.Join(s.outputBase, sessionID)
-	files, err := os.ReadDir(sessionDir)
-
-	if err != nil {
-		http.Error(w, "Session not found", http.StatusNotFound)
-		return
-	}
-
-	var zipName string
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".zip") {
-			zipName = file.Name()
-			break
-		}
-	}
+// sendEvent stamps an event with the protocol version and the next sequence
+// number and writes it to the client.
+func sendEvent(client *WebSocketClient, event ProgressEvent) {
+	client.writeMutex.Lock()
+	defer client.writeMutex.Unlock()
 
-	if zipName == "" {
-		http.Error(w, "Zip file not found", http.StatusNotFound)
+	// Generations outlive their connection; once it is gone their events
+	// are only stored.
+	if client.gone {
 		return
 	}
 
-	zipPath := filepath.Join(sessionDir, zipName)
+	client.seq++
+	event.Version = client.version
+	event.Seq = client.seq
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", zipName))
-	w.Header().Set("Content-Type", "application/zip")
-	http.ServeFile(w, r, zipPath)
-
-}
-
-func sendEvent(client *WebSocketClient, event ProgressEvent) {
-	err := client.WriteJSON(event)
-	if err != nil {
+	client.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := client.conn.WriteJSON(event); err != nil {
 		log.Printf("error writing data to connection: %v\n", err)
+		client.gone = true
 	}
 }
 
+// HandleGetUserHistory lists the generations of the signed in user.
 func (s *Server) HandleGetUserHistory(w http.ResponseWriter, r *http.Request) {
-	// Enable CORS
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	user, ok := token.ContextGetUser(r)
+	if !ok {
+		apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Get user ID from query parameter
-	userIDStr := r.URL.Query().Get("user_id")
-	if userIDStr == "" {
-		http.Error(w, "user_id parameter is required", http.StatusBadRequest)
-		return
-	}
-
-	userID, err := strconv.Atoi(userIDStr)
+	userID, err := strconv.Atoi(user.ID)
 	if err != nil {
-		http.Error(w, "Invalid user_id format", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -327,10 +298,11 @@ func (s *Server) HandleGetUserHistory(w http.ResponseWriter, r *http.Request) {
 	codegens, err := s.codegenModel.GetAllByUserID(userID)
 	if err != nil {
 		log.Printf("Error fetching user history: %v", err)
-		http.Error(w, "Failed to fetch user history", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch user history")
 		return
 	}
 
 	// Convert to JSON and send response
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(codegens)
 }
@@ -0,0 +1,365 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/apierror"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/data"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/storage"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/token"
+)
+
+// maxPreviewSize is the largest file whose content is returned inline.
+const maxPreviewSize = 1 << 20
+
+// TreeNode is a file or directory of a generated project. Directory sizes
+// are the total size of the files below them.
+type TreeNode struct {
+	Name     string      `json:"name"`
+	Path     string      `json:"path"`
+	Type     string      `json:"type"`
+	Size     int64       `json:"size"`
+	Children []*TreeNode `json:"children,omitempty"`
+}
+
+// FileContent is a generated file returned for preview.
+type FileContent struct {
+	Path     string `json:"path"`
+	Language string `json:"language"`
+	Size     int64  `json:"size"`
+	Binary   bool   `json:"binary,omitempty"`
+	// Truncated is set when the file is too large to preview and Content is
+	// left empty.
+	Truncated bool   `json:"truncated,omitempty"`
+	Content   string `json:"content"`
+}
+
+var languagesByExt = map[string]string{
+	".go":     "go",
+	".py":     "python",
+	".js":     "javascript",
+	".mjs":    "javascript",
+	".cjs":    "javascript",
+	".jsx":    "javascript",
+	".ts":     "typescript",
+	".tsx":    "typescript",
+	".java":   "java",
+	".kt":     "kotlin",
+	".rb":     "ruby",
+	".rs":     "rust",
+	".c":      "c",
+	".h":      "c",
+	".cpp":    "cpp",
+	".cs":     "csharp",
+	".php":    "php",
+	".json":   "json",
+	".yaml":   "yaml",
+	".yml":    "yaml",
+	".toml":   "toml",
+	".xml":    "xml",
+	".html":   "html",
+	".css":    "css",
+	".scss":   "scss",
+	".md":     "markdown",
+	".sql":    "sql",
+	".sh":     "shell",
+	".bash":   "shell",
+	".env":    "dotenv",
+	".mod":    "go-mod",
+	".sum":    "text",
+	".txt":    "text",
+	".ini":    "ini",
+	".cfg":    "ini",
+	".gradle": "groovy",
+}
+
+var languagesByName = map[string]string{
+	"Dockerfile":       "dockerfile",
+	"Makefile":         "makefile",
+	"LICENSE":          "text",
+	".gitignore":       "text",
+	".dockerignore":    "text",
+	"requirements.txt": "text",
+}
+
+// detectLanguage guesses the language of a file from its name.
+func detectLanguage(p string) string {
+	name := path.Base(p)
+	if lang, ok := languagesByName[name]; ok {
+		return lang
+	}
+	if lang, ok := languagesByExt[strings.ToLower(path.Ext(name))]; ok {
+		return lang
+	}
+	if strings.HasPrefix(name, ".env") {
+		return "dotenv"
+	}
+	return "text"
+}
+
+// HandleSessionTree serves the file tree of a session, with sizes, to the
+// user who generated it:
+//
+//	GET /api/sessions/{id}/tree
+func (s *Server) HandleSessionTree(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("id")
+
+	prefix, files, ok := s.sessionProject(w, r, sessionID)
+	if !ok {
+		return
+	}
+
+	writeTree(w, sessionID, path.Base(strings.TrimSuffix(prefix, "/")), files)
+}
+
+// HandleSessionFile serves a generated file's content and language to the
+// user who generated it:
+//
+//	GET /api/sessions/{id}/files/{path...}
+func (s *Server) HandleSessionFile(w http.ResponseWriter, r *http.Request) {
+	prefix, files, ok := s.sessionProject(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	s.writeFile(w, r, prefix, files, r.PathValue("path"))
+}
+
+// HandleSessionEvents serves the progress events of a session, as
+// Server-Sent Events, to the user who generated it:
+//
+//	GET /api/sessions/{id}/events
+func (s *Server) HandleSessionEvents(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("id")
+
+	w.Header().Set("Content-Type", "application/json")
+	if !s.authorizeSession(w, r, sessionID) {
+		return
+	}
+
+	s.streamEvents(w, r, sessionID)
+}
+
+// sessionProject authorizes a session request and finds the session's
+// project. It writes the error response and reports false when that fails.
+func (s *Server) sessionProject(w http.ResponseWriter, r *http.Request, sessionID string) (string, []storage.Object, bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !s.authorizeSession(w, r, sessionID) {
+		return "", nil, false
+	}
+
+	prefix, objects, err := s.project(r.Context(), sessionID)
+	if err != nil {
+		if !errors.Is(err, errProjectNotReady) {
+			log.Printf("Error finding project of session %s: %v", sessionID, err)
+		}
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "Session has no generated files")
+		return "", nil, false
+	}
+
+	files, err := s.sessionFiles(r.Context(), prefix, objects)
+	if err != nil {
+		log.Printf("Error listing files of session %s: %v", sessionID, err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list files")
+		return "", nil, false
+	}
+
+	return prefix, files, true
+}
+
+// authorizeSession checks that the session belongs to the authenticated
+// user.
+func (s *Server) authorizeSession(w http.ResponseWriter, r *http.Request, sessionID string) bool {
+	user, _ := token.ContextGetUser(r)
+
+	err := s.checkSessionOwner(user, sessionID)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errNoUser):
+		apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized")
+	case errors.Is(err, data.ErrRecordNotFound):
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "Session not found")
+	case errors.Is(err, errSessionDenied):
+		apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "You do not have access to this session")
+	default:
+		log.Printf("Error loading session %s: %v", sessionID, err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to load session")
+	}
+
+	return false
+}
+
+// streamEvents sends the progress events of a session as Server-Sent Events
+// and follows the generation until it ends. Clients pick up after the event
+// named by the Last-Event-ID header or the lastEventId query parameter.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request, sessionID string) {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+
+	after, err := parseLastEventID(lastEventID)
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+		return
+	}
+
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, err.Error())
+		return
+	}
+
+	stop := sse.startHeartbeat(r.Context())
+	defer stop()
+
+	if err := s.replay(r.Context(), sessionID, after, sse.send); err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("Error streaming events of session %s: %v", sessionID, err)
+	}
+}
+
+// sessionFiles returns the stored files of a project that are listed in its
+// manifest, or everything stored so far while generation runs.
+func (s *Server) sessionFiles(ctx context.Context, prefix string, objects []storage.Object) ([]storage.Object, error) {
+	listed, err := s.projectFiles(ctx, prefix)
+	if errors.Is(err, errProjectNotReady) {
+		return objects, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keep := make(map[string]bool, len(listed))
+	for _, f := range listed {
+		keep[f] = true
+	}
+
+	var files []storage.Object
+	for _, obj := range objects {
+		if keep[obj.Key] {
+			files = append(files, obj)
+		}
+	}
+	return files, nil
+}
+
+func writeTree(w http.ResponseWriter, sessionID, projectName string, files []storage.Object) {
+	root := &TreeNode{Name: projectName, Type: "dir"}
+	dirs := map[string]*TreeNode{"": root}
+
+	for _, f := range files {
+		parent := root
+		dir := ""
+		for _, part := range strings.Split(path.Dir(f.Key), "/") {
+			if part == "." {
+				break
+			}
+			dir = path.Join(dir, part)
+			node, ok := dirs[dir]
+			if !ok {
+				node = &TreeNode{Name: part, Path: dir, Type: "dir"}
+				dirs[dir] = node
+				parent.Children = append(parent.Children, node)
+			}
+			parent = node
+		}
+
+		parent.Children = append(parent.Children, &TreeNode{
+			Name: path.Base(f.Key),
+			Path: f.Key,
+			Type: "file",
+			Size: f.Size,
+		})
+	}
+
+	sortTree(root)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessionId": sessionID,
+		"tree":      root,
+	})
+}
+
+// sortTree orders directories before files, each by name, and totals the
+// directory sizes.
+func sortTree(node *TreeNode) int64 {
+	if node.Type != "dir" {
+		return node.Size
+	}
+
+	node.Size = 0
+	for _, child := range node.Children {
+		node.Size += sortTree(child)
+	}
+
+	sort.Slice(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		if a.Type != b.Type {
+			return a.Type == "dir"
+		}
+		return a.Name < b.Name
+	})
+
+	return node.Size
+}
+
+func (s *Server) writeFile(w http.ResponseWriter, r *http.Request, prefix string, files []storage.Object, rawPath string) {
+	p, err := cleanSubPath(rawPath)
+	if err != nil || p == "" {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid path")
+		return
+	}
+
+	var obj *storage.Object
+	for i := range files {
+		if files[i].Key == p {
+			obj = &files[i]
+			break
+		}
+	}
+	if obj == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "File not found")
+		return
+	}
+
+	file := FileContent{
+		Path:     p,
+		Language: detectLanguage(p),
+		Size:     obj.Size,
+	}
+
+	if obj.Size > maxPreviewSize {
+		file.Truncated = true
+	} else {
+		body, _, err := s.generations.store.Get(r.Context(), prefix+p)
+		if err != nil {
+			apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "File not found")
+			return
+		}
+		content, err := io.ReadAll(io.LimitReader(body, maxPreviewSize+1))
+		body.Close()
+		if err != nil {
+			apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to read file")
+			return
+		}
+
+		if utf8.Valid(content) {
+			file.Content = string(content)
+		} else {
+			file.Binary = true
+		}
+	}
+
+	json.NewEncoder(w).Encode(file)
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sseWriter streams ProgressEvents as Server-Sent Events. Each event's data
+// is the event as JSON; session events also carry their ID, which browsers
+// send back in Last-Event-ID when they reconnect.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	mutex   sync.Mutex
+	seq     int64
+}
+
+// newSSEWriter starts an event stream response.
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming is not supported")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Stop proxies such as nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &sseWriter{w: w, flusher: flusher}, nil
+}
+
+// send writes an event, stamped with the protocol version and the stream's
+// next sequence number.
+func (s *sseWriter) send(event ProgressEvent) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.seq++
+	event.Version = ProtocolVersion
+	event.Seq = s.seq
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if event.ID > 0 {
+		if _, err := fmt.Fprintf(s.w, "id: %d\n", event.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(s.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+
+	s.flusher.Flush()
+	return nil
+}
+
+// startHeartbeat writes a comment every heartbeat interval, so idle streams
+// aren't closed by proxies. The returned function stops it and must be
+// called before the handler returns.
+func (s *sseWriter) startHeartbeat(ctx context.Context) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.mutex.Lock()
+				_, err := fmt.Fprint(s.w, ": ping\n\n")
+				if err == nil {
+					s.flusher.Flush()
+				}
+				s.mutex.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
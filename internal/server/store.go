@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/storage"
+)
+
+// SetArtifactStore sets where finished projects are kept. Generation still
+// happens in the local output directory; projects are copied to the store
+// once their manifest is written.
+func (s *Server) SetArtifactStore(store storage.ArtifactStore) {
+	s.generations.SetArtifactStore(store)
+}
+
+// SetArtifactStore sets where finished projects are kept. Without a store
+// they stay in the output directory.
+func (g *GenerationService) SetArtifactStore(store storage.ArtifactStore) {
+	g.store = store
+}
+
+// storesInPlace reports whether the artifact store is the local output
+// directory itself, so generated files need no copying.
+func (g *GenerationService) storesInPlace() bool {
+	if g.store == nil {
+		return true
+	}
+
+	local, ok := g.store.(*storage.Local)
+	if !ok {
+		return false
+	}
+
+	a, errA := filepath.Abs(local.Root())
+	b, errB := filepath.Abs(g.outputBase)
+	return errA == nil && errB == nil && a == b
+}
+
+// publish copies the files of a finished project to the artifact store.
+func (g *GenerationService) publish(ctx context.Context, sessionID, projectDir string, files []string) error {
+	if g.storesInPlace() {
+		return nil
+	}
+
+	prefix := sessionID + "/" + filepath.Base(projectDir) + "/"
+	for _, name := range files {
+		if err := g.putFile(ctx, prefix+name, filepath.Join(projectDir, filepath.FromSlash(name))); err != nil {
+			return fmt.Errorf("storing %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (g *GenerationService) putFile(ctx context.Context, key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	return g.store.Put(ctx, key, f, info.Size())
+}
+
+// releaseWorkDir removes a session's local working directory once its
+// project lives in a remote artifact store.
+func (g *GenerationService) releaseWorkDir(sessionDir string) {
+	if g.storesInPlace() {
+		return
+	}
+
+	if err := os.RemoveAll(sessionDir); err != nil {
+		log.Printf("Error removing working directory %s: %v", sessionDir, err)
+	}
+}
+
+// ArtifactStore returns the store finished projects are kept in.
+func (s *Server) ArtifactStore() storage.ArtifactStore {
+	return s.generations.store
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/agents"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/validator"
+)
+
+const (
+	maxPromptLength      = 32 << 10
+	maxProjectNameLength = 100
+	maxBasePackageLength = 200
+
+	// defaultWorkerCount is used for requests that don't ask for a number
+	// of workers.
+	defaultWorkerCount = 4
+	maxWorkerCount     = 16
+	maxRepairRounds    = 5
+)
+
+// projectNameRX matches project names that are safe to use as a directory
+// name: no separators, no leading dot.
+var projectNameRX = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateProjectRequest checks a generation request against the given
+// templates, the model catalogue and the server's limits.
+func ValidateProjectRequest(v *validator.Validator, req *ProjectRequest, templates []agents.ProjectTemplate) {
+	v.Check(strings.TrimSpace(req.Prompt) != "", "prompt", "must be provided")
+	v.Check(len(req.Prompt) <= maxPromptLength, "prompt", fmt.Sprintf("must not be more than %d bytes long", maxPromptLength))
+
+	languages := slices.Clone(agents.Languages)
+	for _, tmpl := range templates {
+		if tmpl.Language != "" && !slices.Contains(languages, tmpl.Language) {
+			languages = append(languages, tmpl.Language)
+		}
+	}
+	v.Check(req.Language != "", "language", "must be provided")
+	v.Check(req.Language == "" || validator.PermittedValue(req.Language, languages...), "language", "must be one of "+strings.Join(languages, ", "))
+	_, badLanguage := v.Errors["language"]
+
+	v.Check(req.Template != "", "template", "must be provided")
+	if req.Template != "" {
+		i := slices.IndexFunc(templates, func(tmpl agents.ProjectTemplate) bool {
+			return tmpl.Name == req.Template
+		})
+		if i < 0 {
+			v.AddError("template", "must be an available template")
+		} else if tmpl := templates[i]; tmpl.Language != "" && !badLanguage && tmpl.Language != req.Language {
+			v.AddError("template", fmt.Sprintf("is a %s template, not %s", tmpl.Language, req.Language))
+		}
+	}
+
+	_, known := agents.LookupModel(req.Model)
+	v.Check(req.Model != "", "model", "must be provided")
+	v.Check(req.Model == "" || known, "model", "must be an available model")
+
+	v.Check(req.WorkerCount >= 1 && req.WorkerCount <= maxWorkerCount, "workerCount", fmt.Sprintf("must be between 1 and %d", maxWorkerCount))
+
+	if req.ProjectName != "" {
+		v.Check(len(req.ProjectName) <= maxProjectNameLength, "projectName", fmt.Sprintf("must not be more than %d bytes long", maxProjectNameLength))
+		v.Check(validator.Matches(req.ProjectName, projectNameRX), "projectName", "must only contain letters, digits, dots, dashes and underscores, and not start with a dot")
+	}
+
+	// The Go analyzer rebases imports and go.mod onto the base package.
+	v.Check(req.Language != "go" || strings.TrimSpace(req.BasePackage) != "", "basePackage", "must be provided")
+	v.Check(len(req.BasePackage) <= maxBasePackageLength, "basePackage", fmt.Sprintf("must not be more than %d bytes long", maxBasePackageLength))
+	v.Check(!strings.ContainsAny(req.BasePackage, " \t\r\n\\"), "basePackage", "must not contain spaces or backslashes")
+
+	v.Check(req.RepairRounds >= 0 && req.RepairRounds <= maxRepairRounds, "repairRounds", fmt.Sprintf("must be between 0 and %d", maxRepairRounds))
+	v.Check(req.ContextTokens >= 0, "contextTokens", "must not be negative")
+}
+
+// validationError reports the field errors of an invalid request.
+func validationError(errors map[string]string) *GenerationError {
+	fields := make([]string, 0, len(errors))
+	for field := range errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	problems := make([]string, len(fields))
+	for i, field := range fields {
+		problems[i] = field + " " + errors[field]
+	}
+
+	return &GenerationError{
+		Code:    CodeFailedValidation,
+		Message: "Invalid request: " + strings.Join(problems, "; "),
+		Errors:  errors,
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/agents"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/validator"
+)
+
+func TestValidateProjectRequest(t *testing.T) {
+	templates := []agents.ProjectTemplate{
+		{Name: "go-gin", Language: "go"},
+		{Name: "python-flask", Language: "python"},
+		{Name: "blank"},
+	}
+
+	valid := func() ProjectRequest {
+		return ProjectRequest{
+			Prompt:      "Build a todo API",
+			Language:    "go",
+			Template:    "go-gin",
+			BasePackage: "example.com/todo",
+			Model:       "gpt-4o-mini",
+			WorkerCount: 4,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*ProjectRequest)
+		want   map[string]string
+	}{
+		{"valid", func(*ProjectRequest) {}, map[string]string{}},
+		{
+			"go without a base package",
+			func(r *ProjectRequest) { r.BasePackage = " " },
+			map[string]string{"basePackage": "must be provided"},
+		},
+		{
+			"python without a base package",
+			func(r *ProjectRequest) { r.Language, r.Template, r.BasePackage = "python", "python-flask", "" },
+			map[string]string{},
+		},
+		{
+			"template of another language",
+			func(r *ProjectRequest) { r.Template = "python-flask" },
+			map[string]string{"template": "is a python template, not go"},
+		},
+		{
+			"template without a language",
+			func(r *ProjectRequest) { r.Template = "blank" },
+			map[string]string{},
+		},
+		{
+			"unknown template and model",
+			func(r *ProjectRequest) { r.Template, r.Model = "rails", "gpt-0" },
+			map[string]string{"template": "must be an available template", "model": "must be an available model"},
+		},
+		{
+			"unknown language",
+			func(r *ProjectRequest) { r.Language = "cobol" },
+			map[string]string{"language": "must be one of go, python, javascript, java"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid()
+			tt.modify(&req)
+
+			v := validator.New()
+			ValidateProjectRequest(v, &req, templates)
+
+			if !reflect.DeepEqual(v.Errors, tt.want) {
+				t.Errorf("errors = %v, want %v", v.Errors, tt.want)
+			}
+		})
+	}
+}
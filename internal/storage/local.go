@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Local stores artifacts as files below a root directory.
+type Local struct {
+	root string
+}
+
+// NewLocal returns a store rooted at dir, creating it if needed.
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating artifact directory: %w", err)
+	}
+	return &Local{root: dir}, nil
+}
+
+// Root returns the directory the store writes to.
+func (l *Local) Root() string {
+	return l.root
+}
+
+// path maps a key to a file below the root, rejecting keys that would
+// escape it.
+func (l *Local) path(key string) (string, error) {
+	if key != "" && !fs.ValidPath(strings.TrimSuffix(key, "/")) {
+		return "", fmt.Errorf("invalid artifact key %q", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file so readers never see a partial artifact.
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+
+	// Like List, Get only sees regular files reached without following
+	// symlinks.
+	linfo, err := l.lstat(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, Object{}, ErrNotFound
+		}
+		return nil, Object{}, err
+	}
+
+	// The file may have been swapped between the checks and the open.
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, Object{}, err
+	}
+	if !os.SameFile(info, linfo) {
+		f.Close()
+		return nil, Object{}, ErrNotFound
+	}
+
+	return f, Object{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// lstat returns the file info of the regular file key names, checking every
+// directory on the way from the root. Symlinks anywhere on the path count
+// as missing.
+func (l *Local) lstat(key string) (fs.FileInfo, error) {
+	p := l.root
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		p = filepath.Join(p, part)
+
+		info, err := os.Lstat(p)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, ErrNotFound
+			}
+			return nil, err
+		}
+
+		last := i == len(parts)-1
+		if last && !info.Mode().IsRegular() || !last && !info.IsDir() {
+			return nil, ErrNotFound
+		}
+		if last {
+			return info, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (l *Local) List(ctx context.Context, prefix string) ([]Object, error) {
+	// Walk the deepest directory the prefix names and filter the rest.
+	dir := prefix
+	if i := strings.LastIndex(dir, "/"); i >= 0 {
+		dir = dir[:i]
+	} else {
+		dir = ""
+	}
+
+	start, err := l.path(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []Object
+	err = filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		objects = append(objects, Object{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (l *Local) Delete(ctx context.Context, prefix string) error {
+	// Whole directories are removed in one go; anything else one by one.
+	if strings.HasSuffix(prefix, "/") && prefix != "/" {
+		p, err := l.path(prefix)
+		if err != nil {
+			return err
+		}
+		return os.RemoveAll(p)
+	}
+
+	objects, err := l.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		p, _ := l.path(obj.Key)
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
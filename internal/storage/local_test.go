@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalGetSkipsSymlinks(t *testing.T) {
+	ctx := context.Background()
+	root, outside := t.TempDir(), t.TempDir()
+
+	store, err := NewLocal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put(ctx, "s1/app/main.go", strings.NewReader("package main\n"), -1); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	secret := filepath.Join(outside, "secret")
+	if err := os.WriteFile(secret, []byte("token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(root, "s1", "app", "leak.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "s1", "app", "linked")); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := store.List(ctx, "s1/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Key != "s1/app/main.go" {
+		t.Fatalf("List = %v, want only s1/app/main.go", objects)
+	}
+
+	tests := []struct {
+		key  string
+		want string
+		// notFound expects ErrNotFound, invalid any other error.
+		notFound bool
+		invalid  bool
+	}{
+		{key: "s1/app/main.go", want: "package main\n"},
+		{key: "s1/app/leak.txt", notFound: true},
+		{key: "s1/app/linked/secret", notFound: true},
+		{key: "s1/app", notFound: true},
+		{key: "s1/app/missing.go", notFound: true},
+		{key: "../secret", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			body, obj, err := store.Get(ctx, tt.key)
+			if tt.notFound || tt.invalid {
+				if err == nil {
+					body.Close()
+					t.Fatalf("Get(%q) succeeded, want an error", tt.key)
+				}
+				if tt.notFound && !errors.Is(err, ErrNotFound) {
+					t.Fatalf("Get(%q) error = %v, want ErrNotFound", tt.key, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get(%q): %v", tt.key, err)
+			}
+			defer body.Close()
+
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want || obj.Size != int64(len(tt.want)) {
+				t.Errorf("Get(%q) = %q (size %d), want %q", tt.key, got, obj.Size, tt.want)
+			}
+		})
+	}
+}
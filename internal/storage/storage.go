@@ -0,0 +1,86 @@
+// Package storage keeps generated projects in a local directory or an
+// S3-compatible object store.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when an object doesn't exist.
+var ErrNotFound = errors.New("artifact not found")
+
+// Object describes a stored artifact.
+type Object struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// ArtifactStore stores generated files under slash-separated keys of the
+// form <session>/<project>/<path>.
+type ArtifactStore interface {
+	// Put stores size bytes read from r under key, replacing any object
+	// with the same key.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get opens the object stored under key.
+	Get(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	// List returns the objects whose keys start with prefix, sorted by key.
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// Delete removes every object whose key starts with prefix.
+	Delete(ctx context.Context, prefix string) error
+}
+
+// FS exposes the objects below prefix as a read-only file system, so they
+// can be archived like a directory.
+func FS(ctx context.Context, store ArtifactStore, prefix string) fs.FS {
+	return &storeFS{ctx: ctx, store: store, prefix: strings.TrimSuffix(prefix, "/") + "/"}
+}
+
+type storeFS struct {
+	ctx    context.Context
+	store  ArtifactStore
+	prefix string
+}
+
+func (s *storeFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	body, obj, err := s.store.Get(s.ctx, s.prefix+name)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			err = fs.ErrNotExist
+		}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &storeFile{ReadCloser: body, info: objectInfo{name: path.Base(name), obj: obj}}, nil
+}
+
+type storeFile struct {
+	io.ReadCloser
+	info objectInfo
+}
+
+func (f *storeFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+type objectInfo struct {
+	name string
+	obj  Object
+}
+
+func (i objectInfo) Name() string       { return i.name }
+func (i objectInfo) Size() int64        { return i.obj.Size }
+func (i objectInfo) Mode() fs.FileMode  { return 0644 }
+func (i objectInfo) ModTime() time.Time { return i.obj.ModTime }
+func (i objectInfo) IsDir() bool        { return false }
+func (i objectInfo) Sys() any           { return nil }
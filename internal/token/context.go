@@ -0,0 +1,50 @@
+package token
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/tanvir-rifat007/codegen-ai-react/internal/data"
+)
+
+type contextKey string
+
+const userContextKey = contextKey("user")
+
+// UserFromClaims builds the user a validated token was issued to.
+func UserFromClaims(parsed *jwt.Token) (*data.User, bool) {
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, false
+	}
+
+	id, ok := claims["id"].(string)
+	if !ok || id == "" {
+		return nil, false
+	}
+
+	email, _ := claims["email"].(string)
+	name, _ := claims["name"].(string)
+	activated, _ := claims["activated"].(bool)
+
+	return &data.User{
+		ID:        id,
+		Email:     email,
+		Name:      name,
+		Activated: activated,
+	}, true
+}
+
+// ContextSetUser returns a copy of the request carrying the authenticated
+// user.
+func ContextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// ContextGetUser returns the user set by the auth middleware, if any.
+func ContextGetUser(r *http.Request) (*data.User, bool) {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	return user, ok
+}
@@ -23,7 +23,7 @@ func CreateJWT(user data.User, logger *slog.Logger) string {
 	// Sign the token with the secret
 	tokenString, err := token.SignedString([]byte(jwtSecret))
 	if err != nil {
-		logger.Error("Failed to sign JWT", err)
+		logger.Error("Failed to sign JWT", "err", err)
 		return ""
 	}
 
@@ -0,0 +1,5 @@
+ALTER TABLE codegen
+    DROP COLUMN IF EXISTS session_id,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS tests_passed,
+    DROP COLUMN IF EXISTS test_output;
@@ -0,0 +1,9 @@
+-- Generations recorded before these columns existed have finished.
+ALTER TABLE codegen
+    ADD COLUMN IF NOT EXISTS session_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'complete',
+    ADD COLUMN IF NOT EXISTS tests_passed BOOLEAN,
+    ADD COLUMN IF NOT EXISTS test_output TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE codegen
+    ALTER COLUMN status SET DEFAULT 'running';
@@ -0,0 +1 @@
+ALTER TABLE codegen ADD COLUMN IF NOT EXISTS protocol TEXT NOT NULL DEFAULT 'delimited';
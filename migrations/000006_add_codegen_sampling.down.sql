@@ -0,0 +1 @@
+ALTER TABLE codegen DROP COLUMN IF EXISTS sampling;
@@ -0,0 +1 @@
+ALTER TABLE codegen ADD COLUMN IF NOT EXISTS sampling JSONB NOT NULL DEFAULT '{}';
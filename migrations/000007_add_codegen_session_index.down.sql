@@ -0,0 +1 @@
+DROP INDEX IF EXISTS codegen_session_id_idx;
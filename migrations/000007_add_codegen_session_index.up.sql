@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS codegen_session_id_idx ON codegen (session_id);
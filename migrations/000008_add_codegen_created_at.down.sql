@@ -0,0 +1,2 @@
+ALTER TABLE codegen
+    DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,7 @@
+-- The creation time of existing generations is unknown, so it stays NULL
+-- and the janitor dates their sessions by their files instead.
+ALTER TABLE codegen
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMP(0) WITH TIME ZONE;
+
+ALTER TABLE codegen
+    ALTER COLUMN created_at SET DEFAULT NOW();
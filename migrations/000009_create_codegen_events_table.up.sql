@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS codegen_events (
+    session_id TEXT NOT NULL,
+    seq BIGINT NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (session_id, seq)
+);
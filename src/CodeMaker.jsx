@@ -7,12 +7,19 @@ const AICodeGenerator = () => {
     const [isGenerating, setIsGenerating] = useState(false);
     const [showResults, setShowResults] = useState(false);
     const [downloadUrl, setDownloadUrl] = useState('');
+    const [sessionId, setSessionId] = useState('');
+    const [projectFiles, setProjectFiles] = useState([]);
+    const [preview, setPreview] = useState(null);
     const [sidebarOpen, setSidebarOpen] = useState(window.innerWidth > 768);
     const [chatHistory, setChatHistory] = useState([]);
     const [isLoadingHistory, setIsLoadingHistory] = useState(true);
     const [currentChatId, setCurrentChatId] = useState(null);
     const [editingId, setEditingId] = useState(null);
     const [editingTitle, setEditingTitle] = useState('');
+    const [models, setModels] = useState([
+        { name: 'o3-mini' },
+        { name: 'gpt-4o-mini' },
+    ]);
     const [formData, setFormData] = useState({
         language: 'go',
         template: 'go-gin',
@@ -33,7 +40,9 @@ const AICodeGenerator = () => {
     const fetchUserHistory = async () => {
         try {
             setIsLoadingHistory(true);
-            const response = await fetch(`https://codegen-ai-production.up.railway.app/api/history?user_id=${id}`);
+            const response = await fetch(`https://codegen-ai-production.up.railway.app/api/history`, {
+                credentials: 'include'
+            });
 
             if (!response.ok) {
                 throw new Error(`HTTP error! status: ${response.status}`);
@@ -82,6 +91,69 @@ const AICodeGenerator = () => {
         }
     }, [id]);
 
+    // Flatten the session tree into the list of files for the preview
+    const flattenTree = (node) => {
+        if (node.type === 'file') {
+            return [node];
+        }
+        return (node.children || []).flatMap(flattenTree);
+    };
+
+    // Load the generated file tree once a session completes
+    useEffect(() => {
+        if (!sessionId) {
+            return;
+        }
+
+        fetch(`https://codegen-ai-production.up.railway.app/api/sessions/${sessionId}/tree`, {
+            credentials: 'include'
+        })
+            .then(response => {
+                if (!response.ok) {
+                    throw new Error(`HTTP error! status: ${response.status}`);
+                }
+                return response.json();
+            })
+            .then(data => {
+                setProjectFiles(data.tree ? flattenTree(data.tree) : []);
+            })
+            .catch(error => {
+                console.error('Error fetching project files:', error);
+            });
+    }, [sessionId]);
+
+    const previewFile = async (path) => {
+        try {
+            const encoded = path.split('/').map(encodeURIComponent).join('/');
+            const response = await fetch(`https://codegen-ai-production.up.railway.app/api/sessions/${sessionId}/files/${encoded}`, {
+                credentials: 'include'
+            });
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            setPreview(await response.json());
+        } catch (error) {
+            console.error('Error fetching file:', error);
+        }
+    };
+
+    // Fetch the models the server allows
+    useEffect(() => {
+        fetch('https://codegen-ai-production.up.railway.app/api/models')
+            .then(response => {
+                if (!response.ok) {
+                    throw new Error(`HTTP error! status: ${response.status}`);
+                }
+                return response.json();
+            })
+            .then(data => {
+                if (data.models && data.models.length > 0) {
+                    setModels(data.models);
+                }
+            })
+            .catch(error => console.error('Error fetching models:', error));
+    }, []);
+
     const handleInputChange = (e) => {
         const { name, value } = e.target;
         setFormData(prev => ({
@@ -163,6 +235,9 @@ const AICodeGenerator = () => {
         setShowResults(true);
         setIsGenerating(true);
         setDownloadUrl('');
+        setSessionId('');
+        setProjectFiles([]);
+        setPreview(null);
 
         // Save current generation as new chat if it's a new one
         if (!currentChatId && formData.prompt.trim()) {
@@ -180,52 +255,126 @@ const AICodeGenerator = () => {
             consoleRef.current.innerHTML = '';
         }
 
-        // Connect to WebSocket
-        websocketRef.current = new WebSocket(`wss://codegen-ai-production.up.railway.app/api/generate`);
+        // Events are numbered per session, so a dropped connection can resume
+        // where it left off.
+        const progress = { sessionId: '', lastEventId: 0, finished: false, retries: 0 };
 
-        websocketRef.current.onopen = () => {
-            websocketRef.current.send(JSON.stringify({
-                id: id,
-                ...formData,
-                workerCount: parseInt(formData.workerCount),
-                projectName: formData.projectName || `${formData.language}-project`
-            }));
+        const connect = () => {
+            // Connect to WebSocket
+            websocketRef.current = new WebSocket(`wss://codegen-ai-production.up.railway.app/api/generate`);
 
-            log('info', 'Connected to server. Starting code generation...');
-        };
+            websocketRef.current.onopen = () => {
+                websocketRef.current.send(JSON.stringify({ type: 'hello', versions: [1] }));
+            };
 
-        websocketRef.current.onmessage = (event) => {
-            const data = JSON.parse(event.data);
-
-            switch (data.type) {
-                case 'start':
-                    log('info', data.message);
-                    break;
-                case 'file':
-                    log('info', `Writing file: ${data.file}`);
-                    break;
-                case 'error':
-                    log('error', `Error: ${data.error}`);
-                    setIsGenerating(false);
-                    break;
-                case 'complete':
-                    log('success', data.message);
-                    setDownloadUrl(data.zipUrl);
-                    setIsGenerating(false);
-                    // Refresh history after successful generation
-                    fetchUserHistory();
-                    break;
-            }
-        };
+            websocketRef.current.onmessage = (event) => {
+                const data = JSON.parse(event.data);
+                if (data.id) {
+                    progress.lastEventId = data.id;
+                }
 
-        websocketRef.current.onerror = (error) => {
-            log('error', `WebSocket error: ${error}`);
-            setIsGenerating(false);
-        };
+                switch (data.type) {
+                    case 'hello':
+                        if (progress.sessionId) {
+                            websocketRef.current.send(JSON.stringify({
+                                type: 'resume',
+                                sessionId: progress.sessionId,
+                                lastEventId: progress.lastEventId
+                            }));
+                            log('info', 'Reconnected to server. Resuming progress...');
+                            break;
+                        }
+                        websocketRef.current.send(JSON.stringify({
+                            type: 'generate',
+                            request: {
+                                id: id,
+                                ...formData,
+                                workerCount: parseInt(formData.workerCount),
+                                projectName: formData.projectName || `${formData.language}-project`
+                            }
+                        }));
+                        log('info', 'Connected to server. Starting code generation...');
+                        break;
+                    case 'ping':
+                        websocketRef.current.send(JSON.stringify({ type: 'pong' }));
+                        break;
+                    case 'draining':
+                        log('warning', data.message);
+                        break;
+                    case 'start':
+                        progress.sessionId = data.sessionId || '';
+                        log('info', data.message);
+                        break;
+                    case 'file':
+                        log('info', `Writing file: ${data.file}`);
+                        break;
+                    case 'plan':
+                        log('info', data.file ? `${data.message}: ${data.file}` : data.message);
+                        break;
+                    case 'log':
+                        if (data.kind === 'run' && data.run) {
+                            log(data.run.passed ? 'success' : 'error', data.message);
+                        } else if (data.stream === 'stderr') {
+                            log('error', data.message);
+                        } else {
+                            log('info', data.file ? `${data.message}: ${data.file}` : data.message);
+                        }
+                        break;
+                    case 'usage':
+                        log('info', `Used ${data.usage.totalTokens} tokens in ${data.usage.requests} request(s)`);
+                        break;
+                    case 'warning':
+                        if (data.kind === 'finding') {
+                            log('error', data.file ? `Security finding in ${data.file}: ${data.message}` : `Security finding in prompt: ${data.message}`);
+                        } else if (data.kind === 'issue') {
+                            log('info', `Issue in ${data.file}: ${data.message}`);
+                        } else {
+                            log('error', data.message);
+                        }
+                        break;
+                    case 'error':
+                        if (data.code === 'failed_validation' && data.errors) {
+                            Object.entries(data.errors).forEach(([field, problem]) => {
+                                log('error', `Invalid ${field}: ${problem}`);
+                            });
+                        } else {
+                            log('error', data.code === 'blocked' ? data.message : `Error: ${data.message}`);
+                        }
+                        progress.finished = true;
+                        setIsGenerating(false);
+                        websocketRef.current.close();
+                        break;
+                    case 'complete':
+                        log('success', data.message);
+                        progress.finished = true;
+                        setDownloadUrl(data.downloadUrl);
+                        setSessionId(data.sessionId || '');
+                        setIsGenerating(false);
+                        websocketRef.current.close();
+                        // Refresh history after successful generation
+                        fetchUserHistory();
+                        break;
+                }
+            };
+
+            websocketRef.current.onerror = (error) => {
+                log('error', `WebSocket error: ${error}`);
+            };
+
+            websocketRef.current.onclose = () => {
+                log('info', 'Connection closed');
 
-        websocketRef.current.onclose = () => {
-            log('info', 'Connection closed');
+                if (!progress.finished && progress.sessionId && progress.retries < 5) {
+                    progress.retries++;
+                    log('info', 'Connection lost, reconnecting...');
+                    setTimeout(connect, 2000);
+                } else if (!progress.finished) {
+                    setIsGenerating(false);
+                }
+            };
         };
+
+        connect();
     };
 
     // Handle window resize
@@ -651,6 +800,76 @@ const AICodeGenerator = () => {
                     font-family: "Fira Code", monospace;
                 }
 
+                .preview-section {
+                    display: flex;
+                    gap: 1rem;
+                    margin-top: 1.5rem;
+                    font-family: "Fira Code", monospace;
+                    font-size: 0.85rem;
+                }
+
+                .preview-files {
+                    list-style: none;
+                    margin: 0;
+                    padding: 0;
+                    min-width: 220px;
+                    max-height: 480px;
+                    overflow-y: auto;
+                }
+
+                .preview-files button {
+                    width: 100%;
+                    text-align: left;
+                    padding: 0.3rem 0.5rem;
+                    background: none;
+                    border: none;
+                    color: #ccc;
+                    cursor: pointer;
+                    font-family: inherit;
+                }
+
+                .preview-files button span {
+                    color: #666;
+                }
+
+                .preview-files button.active,
+                .preview-files button:hover {
+                    color: #73d13d;
+                }
+
+                .preview-content {
+                    flex: 1;
+                    min-width: 0;
+                }
+
+                .preview-header {
+                    color: #73d13d;
+                    margin-bottom: 0.5rem;
+                }
+
+                .preview-content pre {
+                    margin: 0;
+                    padding: 1rem;
+                    max-height: 480px;
+                    overflow: auto;
+                    background: #111;
+                    border-radius: 6px;
+                    color: #ddd;
+                }
+
+                .download-formats {
+                    margin-top: 0.75rem;
+                    display: flex;
+                    justify-content: center;
+                    gap: 1rem;
+                    font-family: "Fira Code", monospace;
+                    font-size: 0.85rem;
+                }
+
+                .download-formats a {
+                    color: #73d13d;
+                }
+
                 .download-btn:hover {
                     background: #52c41a;
                     transform: translateY(-3px);
@@ -958,8 +1177,9 @@ const AICodeGenerator = () => {
                                             onChange={handleInputChange}
                                             className="form-select"
                                         >
-                                            <option value="o3-mini">o3-mini</option>
-                                            <option value="gpt-4o-mini">GPT-4o Mini</option>
+                                            {models.map(model => (
+                                                <option key={model.name} value={model.name}>{model.name}</option>
+                                            ))}
                                         </select>
                                     </div>
 
@@ -1008,6 +1228,35 @@ const AICodeGenerator = () => {
                                             <a href={downloadUrl} className="download-btn">
                                                 Download Project
                                             </a>
+                                            <div className="download-formats">
+                                                <a href={`${downloadUrl}?format=tar.gz`}>tar.gz</a>
+                                                <a href={`${downloadUrl}?format=tar.zst`}>tar.zst</a>
+                                            </div>
+                                        </div>
+                                    )}
+
+                                    {projectFiles.length > 0 && (
+                                        <div className="preview-section">
+                                            <ul className="preview-files">
+                                                {projectFiles.map(file => (
+                                                    <li key={file.path}>
+                                                        <button
+                                                            className={preview && preview.path === file.path ? 'active' : ''}
+                                                            onClick={() => previewFile(file.path)}
+                                                        >
+                                                            {file.path} <span>{file.size} B</span>
+                                                        </button>
+                                                    </li>
+                                                ))}
+                                            </ul>
+                                            {preview && (
+                                                <div className="preview-content">
+                                                    <div className="preview-header">{preview.path} · {preview.language}</div>
+                                                    <pre>
+                                                        {preview.binary ? 'Binary file' : preview.truncated ? 'File too large to preview' : preview.content}
+                                                    </pre>
+                                                </div>
+                                            )}
                                         </div>
                                     )}
                                 </div>
@@ -59,7 +59,8 @@ const ForgotPassword = () => {
                 setIsSuccess(true);
                 setToast({ message: "✅ Password reset email sent successfully!", type: "success" });
             } else {
-                const errorMessage = data.error || 'Failed to send reset email';
+                const errorMessage = (typeof data.error === 'string' ? data.error : data.error?.email)
+                    || 'Failed to send reset email';
                 setToast({ message: `⚠️ ${errorMessage}`, type: "error" });
             }
         } catch (error) {
@@ -61,7 +61,10 @@ const ResetPassword = () => {
                 setPassword('');
                 setConfirmPassword('');
             } else {
-                setError(data.message || 'Failed to reset password. Please try again.');
+                const fieldError = data.error && typeof data.error === 'object'
+                    ? Object.values(data.error)[0]
+                    : data.error;
+                setError(fieldError || 'Failed to reset password. Please try again.');
             }
         } catch (err) {
             setError('Network error. Please check your connection and try again.');
@@ -75,10 +75,7 @@ const User = () => {
                 body: JSON.stringify({ name, email, password }),
             });
 
-            if (!response.ok) {
-                throw new Error("Network response was not ok");
-            }
-
+            // Failed sign ups answer with an error envelope the caller shows.
             return response.json();
         }
 
@@ -94,7 +91,10 @@ const User = () => {
 
 
             } else {
-                setToast({ message: `⚠️ ${data.error.email}`, type: "error" });
+                const errorMessage = typeof data.error === 'string'
+                    ? data.error
+                    : Object.entries(data.error || {}).map(([field, msg]) => `${field} ${msg}`).join(', ');
+                setToast({ message: `⚠️ ${errorMessage || 'Sign up failed'}`, type: "error" });
             }
         } catch (err) {
             console.error(err);